@@ -0,0 +1,181 @@
+package main
+
+import (
+  "bytes"
+  "compress/gzip"
+  "fmt"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  /* The value of sumo-compress-level adapting the level to the CPU budget. */
+  compressLevelAuto = "auto"
+  /* How often the level is adapted, from the batches compressed since. */
+  autoCompressionInterval = 10 * time.Second
+  /* The level of the first batches, raised while the budget allows it. */
+  autoCompressionStartLevel = gzip.BestSpeed
+  /* A higher level is only used if it shrinks payloads by at least this fraction. */
+  autoCompressionMinGain = 0.01
+  /* The cost of a level not used yet, relative to the current level. */
+  autoCompressionCostFactor = 1.5
+)
+
+/* compressionStats accumulates the batches compressed at a level. */
+type compressionStats struct {
+  inputBytes int64
+  outputBytes int64
+  encodeTime time.Duration
+}
+
+func (compressionStats *compressionStats) add(inputBytes int, outputBytes int, encodeTime time.Duration) {
+  compressionStats.inputBytes += int64(inputBytes)
+  compressionStats.outputBytes += int64(outputBytes)
+  compressionStats.encodeTime += encodeTime
+}
+
+/* ratio returns the compressed size relative to the input size. */
+func (compressionStats *compressionStats) ratio() float64 {
+  return float64(compressionStats.outputBytes) / float64(compressionStats.inputBytes)
+}
+
+/* cost returns the encode time per input byte, in nanoseconds. */
+func (compressionStats *compressionStats) cost() float64 {
+  return float64(compressionStats.encodeTime) / float64(compressionStats.inputBytes)
+}
+
+/* autoCompression picks the compression level of a logger. It tracks the ratio and encode time of each level,
+  and moves to a faster level when compressing takes more than the budget, a fraction of the elapsed time,
+  or to a slower one when the budget allows it and the payloads got smaller enough. */
+type autoCompression struct {
+  mu sync.Mutex
+  budget float64
+  currentLevel int
+  levels [gzip.BestCompression + 1]compressionStats
+  window compressionStats
+  windowStart time.Time
+}
+
+func newAutoCompression(budget float64, now time.Time) *autoCompression {
+  return &autoCompression{
+    budget: budget,
+    currentLevel: autoCompressionStartLevel,
+    windowStart: now,
+  }
+}
+
+func (autoCompression *autoCompression) level() int {
+  autoCompression.mu.Lock()
+  defer autoCompression.mu.Unlock()
+  return autoCompression.currentLevel
+}
+
+/* observe records a batch compressed at the level, adapting the level at the end of each interval. */
+func (autoCompression *autoCompression) observe(level int, inputBytes int, outputBytes int, encodeTime time.Duration, now time.Time) {
+  autoCompression.mu.Lock()
+  defer autoCompression.mu.Unlock()
+  if level >= gzip.BestSpeed && level <= gzip.BestCompression {
+    autoCompression.levels[level].add(inputBytes, outputBytes, encodeTime)
+  }
+  autoCompression.window.add(inputBytes, outputBytes, encodeTime)
+  if now.Sub(autoCompression.windowStart) >= autoCompressionInterval {
+    autoCompression.adapt(now)
+  }
+}
+
+func (autoCompression *autoCompression) adapt(now time.Time) {
+  usage := float64(autoCompression.window.encodeTime) / float64(now.Sub(autoCompression.windowStart))
+  current := &autoCompression.levels[autoCompression.currentLevel]
+  if usage > autoCompression.budget {
+    if autoCompression.currentLevel > gzip.BestSpeed {
+      autoCompression.currentLevel--
+    }
+  } else if autoCompression.currentLevel < gzip.BestCompression && current.inputBytes > 0 {
+    next := &autoCompression.levels[autoCompression.currentLevel + 1]
+    estimatedUsage := usage * autoCompressionCostFactor
+    worthIt := true
+    if next.inputBytes > 0 {
+      estimatedUsage = usage * next.cost() / current.cost()
+      worthIt = (current.ratio() - next.ratio()) / current.ratio() >= autoCompressionMinGain
+    }
+    if estimatedUsage <= autoCompression.budget && worthIt {
+      autoCompression.currentLevel++
+    }
+  }
+  /* older observations weigh less, so that levels are tried again as the logs change */
+  for level := range autoCompression.levels {
+    stats := &autoCompression.levels[level]
+    stats.inputBytes /= 2
+    stats.outputBytes /= 2
+    stats.encodeTime /= 2
+  }
+  autoCompression.window = compressionStats{}
+  autoCompression.windowStart = now
+}
+
+func isAutoCompressionLevel(input string) bool {
+  return strings.EqualFold(strings.TrimSpace(input), compressLevelAuto)
+}
+
+/* parseLogOptAutoCompression returns the adaptive compression of a logger with sumo-compress-level=auto, or nil. */
+func parseLogOptAutoCompression(info logger.Info) *autoCompression {
+  if !isAutoCompressionLevel(info.Config[logOptGzipCompressionLevel]) {
+    return nil
+  }
+  return newAutoCompression(parseLogOptCpuBudget(info, logOptCompressCpuBudget, defaultCompressCpuBudget), time.Now())
+}
+
+func parseLogOptCpuBudget(info logger.Info, logOptKey string, defaultValue float64) float64 {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseCpuBudget(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %g%%", pluginName, err, defaultValue * 100))
+      return defaultValue
+    }
+    return inputValue
+  }
+  return defaultValue
+}
+
+/* parseCpuBudget parses a percentage of one CPU, e.g. 5 or 5%, returning it as a fraction. */
+func parseCpuBudget(logOptKey string, input string) (float64, error) {
+  percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(input), "%"), 64)
+  if err != nil {
+    return 0, fmt.Errorf("Failed to parse value of %s as percentage. %v", logOptKey, err)
+  }
+  if percent <= 0 || percent > 100 {
+    return 0, fmt.Errorf("%s must be a percentage between 0 and 100, got %g", logOptKey, percent)
+  }
+  return percent / 100, nil
+}
+
+/* writeMessageAdaptive compresses the logs, feeding the encode time and ratio to the adaptive level if enabled. */
+func (sumoLogger *sumoLogger) writeMessageAdaptive(writer *bytes.Buffer, logs []*sumoLog) error {
+  if sumoLogger.autoCompression == nil {
+    return sumoLogger.writeMessageCompressed(writer, logs)
+  }
+  level := sumoLogger.autoCompression.level()
+  start := time.Now()
+  initialLen := writer.Len()
+  if err := sumoLogger.writeMessageCodec(writer, logs, sumoLogger.contentEncoding(), level); err != nil {
+    return err
+  }
+  now := time.Now()
+  sumoLogger.autoCompression.observe(level, logsSize(logs), writer.Len() - initialLen, now.Sub(start), now)
+  sumoLogger.setMetric(metricCompressLevel, int64(sumoLogger.autoCompression.level()))
+  return nil
+}
+
+/* logsSize returns the size of the logs once written, uncompressed. */
+func logsSize(logs []*sumoLog) int {
+  size := 0
+  for _, log := range logs {
+    size += len(log.line) + len(newline)
+  }
+  return size
+}
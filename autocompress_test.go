@@ -0,0 +1,141 @@
+package main
+
+import (
+  "compress/gzip"
+  "net/http"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestAutoCompression(t *testing.T) {
+  start := time.Now()
+
+  t.Run("raise level within budget", func(t *testing.T) {
+    testAutoCompression := newAutoCompression(0.05, start)
+    /* 10ms of compression in 10s, far below the budget */
+    testAutoCompression.observe(gzip.BestSpeed, 1000000, 200000, 10 * time.Millisecond, start.Add(autoCompressionInterval))
+    assert.Equal(t, gzip.BestSpeed + 1, testAutoCompression.level(), "should move to a better compression")
+  })
+
+  t.Run("lower level over budget", func(t *testing.T) {
+    testAutoCompression := newAutoCompression(0.05, start)
+    testAutoCompression.currentLevel = 6
+    /* 1s of compression in 10s, over the budget */
+    testAutoCompression.observe(6, 1000000, 200000, time.Second, start.Add(autoCompressionInterval))
+    assert.Equal(t, 5, testAutoCompression.level(), "should move to a faster compression")
+
+    testAutoCompression = newAutoCompression(0.05, start)
+    testAutoCompression.observe(gzip.BestSpeed, 1000000, 200000, time.Second, start.Add(autoCompressionInterval))
+    assert.Equal(t, gzip.BestSpeed, testAutoCompression.level(), "should not go below the fastest compression")
+  })
+
+  t.Run("keep level until the interval ends", func(t *testing.T) {
+    testAutoCompression := newAutoCompression(0.05, start)
+    testAutoCompression.observe(gzip.BestSpeed, 1000000, 200000, 10 * time.Millisecond, start.Add(time.Second))
+    assert.Equal(t, gzip.BestSpeed, testAutoCompression.level(), "should not adapt before the interval")
+  })
+
+  t.Run("keep level if the next one costs too much", func(t *testing.T) {
+    testAutoCompression := newAutoCompression(0.05, start)
+    testAutoCompression.currentLevel = 4
+    testAutoCompression.levels[5].add(1000000, 190000, 600 * time.Millisecond)
+    testAutoCompression.observe(4, 1000000, 200000, 300 * time.Millisecond, start.Add(autoCompressionInterval))
+    assert.Equal(t, 4, testAutoCompression.level(), "level 5 would take 6% of the time, over the budget")
+  })
+
+  t.Run("keep level if the next one doesn't compress better", func(t *testing.T) {
+    testAutoCompression := newAutoCompression(0.05, start)
+    testAutoCompression.currentLevel = 4
+    testAutoCompression.levels[5].add(1000000, 199900, 11 * time.Millisecond)
+    testAutoCompression.observe(4, 1000000, 200000, 10 * time.Millisecond, start.Add(autoCompressionInterval))
+    assert.Equal(t, 4, testAutoCompression.level(), "level 5 gains less than the minimum")
+
+    testAutoCompression.levels[5].add(1000000, 100000, 11 * time.Millisecond)
+    testAutoCompression.observe(4, 1000000, 200000, 10 * time.Millisecond, start.Add(2 * autoCompressionInterval))
+    assert.Equal(t, 5, testAutoCompression.level(), "level 5 gains enough")
+  })
+
+  t.Run("not above the best compression", func(t *testing.T) {
+    testAutoCompression := newAutoCompression(0.05, start)
+    testAutoCompression.currentLevel = gzip.BestCompression
+    testAutoCompression.observe(gzip.BestCompression, 1000000, 200000, time.Millisecond, start.Add(autoCompressionInterval))
+    assert.Equal(t, gzip.BestCompression, testAutoCompression.level())
+  })
+}
+
+func TestParseLogOptAutoCompression(t *testing.T) {
+  info := logger.Info{
+    Config: map[string]string{
+      logOptGzipCompressionLevel: "9",
+    },
+  }
+  assert.Nil(t, parseLogOptAutoCompression(info), "fixed level, should not adapt")
+
+  info.Config[logOptGzipCompressionLevel] = "auto"
+  testAutoCompression := parseLogOptAutoCompression(info)
+  assert.NotNil(t, testAutoCompression, "auto level, should adapt")
+  assert.Equal(t, defaultCompressCpuBudget, testAutoCompression.budget, "budget not specified, should be default value")
+  assert.Equal(t, defaultGzipCompressionLevel, parseLogOptGzipCompressionLevel(info, logOptGzipCompressionLevel, defaultGzipCompressionLevel),
+    "auto level, fixed level should be default value")
+  assert.Nil(t, validateGzipCompressionLevel(logOptGzipCompressionLevel, "auto"), "should validate auto")
+
+  info.Config[logOptCompressCpuBudget] = "10%"
+  assert.Equal(t, 0.1, parseLogOptAutoCompression(info).budget, "budget specified, should be specified value")
+  info.Config[logOptCompressCpuBudget] = "2.5"
+  assert.Equal(t, 0.025, parseLogOptAutoCompression(info).budget, "budget specified without %, should be specified value")
+  info.Config[logOptCompressCpuBudget] = "150%"
+  assert.Equal(t, defaultCompressCpuBudget, parseLogOptAutoCompression(info).budget, "budget over 100%, should be default value")
+  assert.NotNil(t, validateCpuBudget(logOptCompressCpuBudget, "0"), "should not validate a zero budget")
+}
+
+func TestCompressMinSizeWithAutoCompression(t *testing.T) {
+  info := logger.Info{
+    Config: map[string]string{
+      logOptUrl: testHttpSourceUrl,
+      logOptGzipCompressionLevel: "auto",
+    },
+    ContainerName: testContainerName,
+  }
+  testSumoLogger, err := newSumoDestination(info, NewMockHttpClient(http.StatusOK), "", nil)
+  assert.Nil(t, err)
+  assert.Equal(t, defaultAutoCompressMinSizeBytes, testSumoLogger.compressMinSize, "auto level, should skip compressing tiny batches")
+
+  info.Config[logOptCompressMinSize] = "0"
+  assert.Empty(t, invalidLogOpts(info), "zero min size, should be valid")
+  testSumoLogger, err = newSumoDestination(info, NewMockHttpClient(http.StatusOK), "", nil)
+  assert.Nil(t, err)
+  assert.Equal(t, 0, testSumoLogger.compressMinSize, "zero min size, should compress every batch")
+}
+
+func TestEncodeLogBatchCompressMinSize(t *testing.T) {
+  testSumoLogger := &sumoLogger{
+    gzipCompression: true,
+    gzipCompressionLevel: defaultGzipCompressionLevel,
+    autoCompression: newAutoCompression(defaultCompressCpuBudget, time.Now()),
+    compressMinSize: 100,
+    metrics: newSumoMetrics(t.Name()),
+  }
+  defer deleteSumoMetrics(t.Name())
+
+  tinyBatch := &sumoLogBatch{logs: []*sumoLog{{line: []byte("tiny")}}}
+  payload, err := testSumoLogger.encodeLogBatch(tinyBatch)
+  assert.Nil(t, err)
+  assert.Equal(t, "", payload.contentEncoding, "should not compress tiny batches")
+  assert.Equal(t, "tiny\n", string(payload.Bytes()))
+  assert.Equal(t, "1", testSumoLogger.metrics.Get(metricUncompressedBatches).String(), "should count the uncompressed batches")
+  payload.release()
+
+  var logs []*sumoLog
+  for i := 0; i < 10; i++ {
+    logs = append(logs, &sumoLog{line: []byte("a line long enough to compress")})
+  }
+  largeBatch := &sumoLogBatch{logs: logs}
+  payload, err = testSumoLogger.encodeLogBatch(largeBatch)
+  assert.Nil(t, err)
+  assert.Equal(t, compressCodecGzip, payload.contentEncoding, "should compress larger batches")
+  assert.Equal(t, "1", testSumoLogger.metrics.Get(metricCompressLevel).String(), "should report the level")
+  payload.release()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+  "compress/gzip"
+  "compress/zlib"
+  "fmt"
+  "io"
+  "strings"
+  "sync"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/klauspost/compress/zstd"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  compressCodecGzip = "gzip"
+  /* As in HTTP, deflate is the zlib format (RFC 1950), not raw deflate. */
+  compressCodecDeflate = "deflate"
+  compressCodecZstd = "zstd"
+)
+
+/* The supported codecs, each being the Content-Encoding of the requests compressed with it. */
+var compressCodecs = []string{compressCodecGzip, compressCodecDeflate, compressCodecZstd}
+
+func parseLogOptCompressCodec(info logger.Info, logOptKey string, defaultValue string) string {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseCompressCodec(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %s", pluginName, err, defaultValue))
+      return defaultValue
+    }
+    return inputValue
+  }
+  return defaultValue
+}
+
+func parseCompressCodec(logOptKey string, input string) (string, error) {
+  codec := strings.ToLower(strings.TrimSpace(input))
+  for _, compressCodec := range compressCodecs {
+    if codec == compressCodec {
+      return codec, nil
+    }
+  }
+  return "", fmt.Errorf("Not supported codec '%s' for %s (supported values are %s)",
+    input, logOptKey, strings.Join(compressCodecs, ", "))
+}
+
+/* contentEncoding returns the codec of the compressed requests, gzip unless set. */
+func (sumoLogger *sumoLogger) contentEncoding() string {
+  if sumoLogger.compressCodec == "" {
+    return compressCodecGzip
+  }
+  return sumoLogger.compressCodec
+}
+
+/* writeMessageCompressed writes the logs compressed with the codec and level of the logger. */
+func (sumoLogger *sumoLogger) writeMessageCompressed(writer io.Writer, logs []*sumoLog) error {
+  return sumoLogger.writeMessageCodec(writer, logs, sumoLogger.contentEncoding(), sumoLogger.compressionLevel())
+}
+
+/* compressionLevel returns the level of the next batch, which changes over time with sumo-compress-level=auto. */
+func (sumoLogger *sumoLogger) compressionLevel() int {
+  if sumoLogger.autoCompression != nil {
+    return sumoLogger.autoCompression.level()
+  }
+  return sumoLogger.gzipCompressionLevel
+}
+
+func (sumoLogger *sumoLogger) writeMessageCodec(writer io.Writer, logs []*sumoLog, codec string, level int) error {
+  compressor, err := getCompressWriter(codec, level, writer)
+  if err != nil {
+    return err
+  }
+  if err := sumoLogger.writeMessage(compressor, logs); err != nil {
+    return err
+  }
+  if err := compressor.Close(); err != nil {
+    return err
+  }
+  putCompressWriter(codec, level, compressor)
+  return nil
+}
+
+/* compressWriter is implemented by the writers of every codec, which can be reset to write a new stream. */
+type compressWriter interface {
+  io.WriteCloser
+  Reset(writer io.Writer)
+}
+
+/* Compression writers are reused across batches, with a pool for each codec and level from -1 to 9. */
+var compressWriterPools = map[string]*[gzip.BestCompression - gzip.DefaultCompression + 1]sync.Pool{
+  compressCodecGzip: {},
+  compressCodecDeflate: {},
+  compressCodecZstd: {},
+}
+
+func compressWriterPool(codec string, level int) *sync.Pool {
+  pools, exists := compressWriterPools[codec]
+  if !exists || level < gzip.DefaultCompression || level > gzip.BestCompression {
+    return nil
+  }
+  return &pools[level - gzip.DefaultCompression]
+}
+
+func getCompressWriter(codec string, level int, writer io.Writer) (compressWriter, error) {
+  if pool := compressWriterPool(codec, level); pool != nil {
+    if pooledWriter, ok := pool.Get().(compressWriter); ok {
+      pooledWriter.Reset(writer)
+      return pooledWriter, nil
+    }
+  }
+  return newCompressWriter(codec, level, writer)
+}
+
+/* putCompressWriter returns a closed writer to its pool. Writers that failed are not reused. */
+func putCompressWriter(codec string, level int, compressor compressWriter) {
+  if pool := compressWriterPool(codec, level); pool != nil {
+    pool.Put(compressor)
+  }
+}
+
+func newCompressWriter(codec string, level int, writer io.Writer) (compressWriter, error) {
+  switch codec {
+  case compressCodecDeflate:
+    zlibWriter, err := zlib.NewWriterLevel(writer, level)
+    if err != nil {
+      return nil, err
+    }
+    return zlibWriter, nil
+  case compressCodecZstd:
+    zstdWriter, err := zstd.NewWriter(writer,
+      zstd.WithEncoderLevel(zstdEncoderLevel(level)),
+      zstd.WithEncoderConcurrency(1))
+    if err != nil {
+      return nil, err
+    }
+    return zstdWriter, nil
+  default:
+    gzipWriter, err := gzip.NewWriterLevel(writer, level)
+    if err != nil {
+      return nil, err
+    }
+    return gzipWriter, nil
+  }
+}
+
+/* zstdEncoderLevel maps a compression level of sumo-compress-level, -1 to 9, to a zstd encoder level.
+  zstd has no level without compression, so 0 is its fastest level. */
+func zstdEncoderLevel(level int) zstd.EncoderLevel {
+  switch {
+  case level == gzip.DefaultCompression:
+    return zstd.SpeedDefault
+  case level < 3:
+    return zstd.SpeedFastest
+  case level < 6:
+    return zstd.SpeedDefault
+  case level < gzip.BestCompression:
+    return zstd.SpeedBetterCompression
+  default:
+    return zstd.SpeedBestCompression
+  }
+}
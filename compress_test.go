@@ -0,0 +1,92 @@
+package main
+
+import (
+  "bytes"
+  "compress/gzip"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/klauspost/compress/zstd"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestParseLogOptCompressCodec(t *testing.T) {
+  info := logger.Info{
+    Config: map[string]string{
+      logOptCompressCodec: "ZSTD",
+    },
+  }
+  assert.Equal(t, compressCodecZstd, parseLogOptCompressCodec(info, logOptCompressCodec, defaultCompressCodec),
+    "should accept codecs in any case")
+
+  info.Config[logOptCompressCodec] = "brotli"
+  assert.Equal(t, defaultCompressCodec, parseLogOptCompressCodec(info, logOptCompressCodec, defaultCompressCodec),
+    "not supported codec, should be default value")
+  assert.NotNil(t, validateCompressCodec(logOptCompressCodec, "brotli"), "should not validate a not supported codec")
+
+  delete(info.Config, logOptCompressCodec)
+  assert.Equal(t, defaultCompressCodec, parseLogOptCompressCodec(info, logOptCompressCodec, defaultCompressCodec),
+    "codec not specified, should be default value")
+}
+
+func TestWriteMessageCompressed(t *testing.T) {
+  testLogs := []*sumoLog{{source: testSource, line: testLine}, {source: testSource, line: testLine}}
+  expected := append(append(testLine, '\n'), append(testLine, '\n')...)
+
+  for _, codec := range compressCodecs {
+    t.Run(codec, func(t *testing.T) {
+      for _, level := range []int{gzip.DefaultCompression, gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression} {
+        testSumoLogger := &sumoLogger{
+          gzipCompression: true,
+          gzipCompressionLevel: level,
+          compressCodec: codec,
+        }
+        var testLogsBatch bytes.Buffer
+        assert.Nil(t, testSumoLogger.writeMessageCompressed(&testLogsBatch, testLogs), "should be no error compressing")
+        reader, err := decodeRequestBody(codec, &testLogsBatch)
+        assert.Nil(t, err, "should be in the %s format", codec)
+        content, _ := ioutil.ReadAll(reader)
+        assert.Nil(t, reader.Close())
+        assert.Equal(t, expected, content, "should decompress to all the logs, level %d", level)
+      }
+    })
+  }
+}
+
+func TestZstdEncoderLevel(t *testing.T) {
+  assert.Equal(t, zstd.SpeedDefault, zstdEncoderLevel(gzip.DefaultCompression))
+  assert.Equal(t, zstd.SpeedFastest, zstdEncoderLevel(gzip.NoCompression))
+  assert.Equal(t, zstd.SpeedFastest, zstdEncoderLevel(gzip.BestSpeed))
+  assert.Equal(t, zstd.SpeedDefault, zstdEncoderLevel(4))
+  assert.Equal(t, zstd.SpeedBetterCompression, zstdEncoderLevel(7))
+  assert.Equal(t, zstd.SpeedBestCompression, zstdEncoderLevel(gzip.BestCompression))
+}
+
+func TestSendLogsCompressCodec(t *testing.T) {
+  var contentEncodings []string
+  receiver, _ := newSumoReceiver(receiverFailures{})
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    contentEncodings = append(contentEncodings, r.Header.Get("Content-Encoding"))
+    receiver.ServeHTTP(w, r)
+  }))
+  defer server.Close()
+
+  for _, codec := range append(compressCodecs, "") {
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: server.URL,
+      httpClient: &http.Client{},
+      gzipCompression: true,
+      gzipCompressionLevel: defaultGzipCompressionLevel,
+      compressCodec: codec,
+    }
+    assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: []byte("sent with " + codec)}}), "should be accepted")
+  }
+  assert.Equal(t, []string{"gzip", "deflate", "zstd", "gzip"}, contentEncodings,
+    "should set the Content-Encoding of the codec, gzip if not set")
+  messages := receiver.query("", "", "", "sent with")
+  assert.Equal(t, 4, len(messages), "should decompress every codec")
+  assert.Equal(t, "sent with zstd", messages[2].Message)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "time"
+)
+
+/* Matches the parts of a line that are ignored when comparing lines in fuzzy mode,
+  e.g. timestamps, counters and request ids. */
+var dedupFuzzyPattern = regexp.MustCompile(`[0-9]+`)
+
+/* sumoLogDedup collapses runs of consecutive identical lines. The first line of a run
+  is always sent; repeats within the window are counted and replaced by a single summary line. */
+type sumoLogDedup struct {
+  window time.Duration
+  fuzzy bool
+
+  first *sumoLog
+  key string
+  repeatCount int
+  firstSeen time.Time
+  lastSeen time.Time
+}
+
+func newSumoLogDedup(window time.Duration, fuzzy bool) *sumoLogDedup {
+  return &sumoLogDedup{
+    window: window,
+    fuzzy: fuzzy,
+  }
+}
+
+/* dedupKey returns what a line must have in common with the first line of the run to be collapsed into it.
+  The stream is part of it, so that the summary keeps the stream of every line it replaces. */
+func (dedup *sumoLogDedup) dedupKey(log *sumoLog) string {
+  if dedup.fuzzy {
+    return log.source + ":" + string(dedupFuzzyPattern.ReplaceAll(log.line, []byte("#")))
+  }
+  return log.source + ":" + string(log.line)
+}
+
+/* filter returns the logs that should be batched for the given input log:
+  nothing if it repeats the current run, otherwise the summary of the previous run (if any)
+  followed by the log itself. Partial logs are never held back. */
+func (dedup *sumoLogDedup) filter(log *sumoLog, now time.Time) []*sumoLog {
+  if dedup == nil {
+    return []*sumoLog{log}
+  }
+  var logs []*sumoLog
+  /* the chunks of a long line are all needed to put it back together, so they are never collapsed,
+    and end the current run, the last chunk of a line not repeating the end of another one */
+  if log.isPartial {
+    if summary := dedup.flush(); summary != nil {
+      logs = append(logs, summary)
+    }
+    return append(logs, log)
+  }
+  key := dedup.dedupKey(log)
+  if dedup.first != nil && key == dedup.key && now.Sub(dedup.firstSeen) <= dedup.window {
+    dedup.repeatCount++
+    dedup.lastSeen = now
+    return nil
+  }
+  if summary := dedup.flush(); summary != nil {
+    logs = append(logs, summary)
+  }
+  dedup.first = log
+  dedup.key = key
+  dedup.firstSeen = now
+  dedup.lastSeen = now
+  return append(logs, log)
+}
+
+/* expire closes the current run if its window has elapsed, returning its summary line (if any). */
+func (dedup *sumoLogDedup) expire(now time.Time) *sumoLog {
+  if dedup == nil || dedup.first == nil || now.Sub(dedup.firstSeen) <= dedup.window {
+    return nil
+  }
+  return dedup.flush()
+}
+
+/* flush closes the current run, returning its summary line if the first line was repeated. */
+func (dedup *sumoLogDedup) flush() *sumoLog {
+  if dedup == nil || dedup.first == nil {
+    return nil
+  }
+  var summary *sumoLog
+  if dedup.repeatCount > 0 {
+    summary = &sumoLog{
+      line: []byte(fmt.Sprintf("%s: last message repeated %d times over %s",
+        pluginName, dedup.repeatCount, dedup.lastSeen.Sub(dedup.firstSeen).String())),
+      source: dedup.first.source,
+      time: dedup.lastSeen,
+      repeats: dedup.first,
+    }
+  }
+  dedup.first = nil
+  dedup.key = ""
+  dedup.repeatCount = 0
+  return summary
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestDedupFilter(t *testing.T) {
+  testStart := time.Unix(testTime, 0)
+  testSumoLog := &sumoLog{
+    source: testSource,
+    line: testLine,
+    isPartial: testIsPartial,
+  }
+  testOtherSumoLog := &sumoLog{
+    source: testSource,
+    line: []byte("another test log message"),
+    isPartial: testIsPartial,
+  }
+
+  t.Run("dedup disabled", func(t *testing.T) {
+    var testDedup *sumoLogDedup
+    for i := 0; i < 10; i++ {
+      assert.Equal(t, []*sumoLog{testSumoLog}, testDedup.filter(testSumoLog, testStart),
+        "should pass every log through when dedup is disabled")
+    }
+    assert.Nil(t, testDedup.expire(testStart), "should never summarize when dedup is disabled")
+    assert.Nil(t, testDedup.flush(), "should never summarize when dedup is disabled")
+  })
+
+  t.Run("repeated lines within window", func(t *testing.T) {
+    testDedup := newSumoLogDedup(time.Minute, false)
+    assert.Equal(t, []*sumoLog{testSumoLog}, testDedup.filter(testSumoLog, testStart),
+      "should send the first line of a run")
+    testRepeatCount := 1000
+    for i := 1; i <= testRepeatCount; i++ {
+      assert.Nil(t, testDedup.filter(testSumoLog, testStart.Add(time.Duration(i) * time.Millisecond)),
+        "should hold back repeated lines")
+    }
+    testLogs := testDedup.filter(testOtherSumoLog, testStart.Add(2 * time.Second))
+    assert.Equal(t, 2, len(testLogs), "should send the summary and the new line")
+    assert.Contains(t, string(testLogs[0].line), "repeated 1000 times over 1s",
+      "summary should contain the repeat count and time span")
+    assert.Equal(t, testSource, testLogs[0].source, "summary should keep the source of the repeated line")
+    assert.Equal(t, testOtherSumoLog, testLogs[1], "should send the new line after the summary")
+  })
+
+  t.Run("single line is not summarized", func(t *testing.T) {
+    testDedup := newSumoLogDedup(time.Minute, false)
+    testDedup.filter(testSumoLog, testStart)
+    testLogs := testDedup.filter(testOtherSumoLog, testStart)
+    assert.Equal(t, []*sumoLog{testOtherSumoLog}, testLogs, "should not summarize a line that was not repeated")
+    assert.Nil(t, testDedup.flush(), "should not summarize a line that was not repeated")
+  })
+
+  t.Run("repeated lines after window", func(t *testing.T) {
+    testDedup := newSumoLogDedup(time.Second, false)
+    testDedup.filter(testSumoLog, testStart)
+    testDedup.filter(testSumoLog, testStart.Add(500 * time.Millisecond))
+    assert.Nil(t, testDedup.expire(testStart.Add(time.Second)), "should not expire a run within its window")
+    summary := testDedup.expire(testStart.Add(2 * time.Second))
+    assert.NotNil(t, summary, "should summarize a run once its window has elapsed")
+    assert.True(t, strings.HasSuffix(string(summary.line), "repeated 1 times over 500ms"),
+      "summary should contain the repeat count and time span")
+    assert.Equal(t, []*sumoLog{testSumoLog}, testDedup.filter(testSumoLog, testStart.Add(3 * time.Second)),
+      "should start a new run after the window has elapsed")
+  })
+
+  t.Run("same line on another stream", func(t *testing.T) {
+    testStderrLog := &sumoLog{
+      source: "stderr",
+      line: testLine,
+      isPartial: testIsPartial,
+    }
+    testDedup := newSumoLogDedup(time.Minute, false)
+    testDedup.filter(testSumoLog, testStart)
+    testDedup.filter(testSumoLog, testStart)
+    testLogs := testDedup.filter(testStderrLog, testStart)
+    assert.Equal(t, 2, len(testLogs), "should not collapse a line of another stream")
+    assert.Equal(t, testSource, testLogs[0].source, "summary should have the stream of the repeated line")
+    assert.Equal(t, testStderrLog, testLogs[1], "should send the line of the other stream")
+  })
+
+  t.Run("partial chunks", func(t *testing.T) {
+    testChunk := &sumoLog{source: testSource, line: []byte(strings.Repeat("x", 16384)), isPartial: true}
+    testLastChunk := &sumoLog{source: testSource, line: []byte("end")}
+    testDedup := newSumoLogDedup(time.Minute, false)
+    testDedup.filter(testSumoLog, testStart)
+    testDedup.filter(testSumoLog, testStart)
+    testLogs := testDedup.filter(testChunk, testStart)
+    assert.Equal(t, 2, len(testLogs), "should end the run before a partial chunk")
+    assert.Contains(t, string(testLogs[0].line), "repeated 1 times")
+    assert.Equal(t, testChunk, testLogs[1])
+    for i := 0; i < 3; i++ {
+      assert.Equal(t, []*sumoLog{testChunk}, testDedup.filter(testChunk, testStart),
+        "should pass every chunk of a long line through")
+    }
+    assert.Equal(t, []*sumoLog{testLastChunk}, testDedup.filter(testLastChunk, testStart))
+    assert.Equal(t, []*sumoLog{testChunk}, testDedup.filter(testChunk, testStart), "should pass the next long line through")
+    assert.Equal(t, []*sumoLog{testLastChunk}, testDedup.filter(testLastChunk, testStart),
+      "should not collapse the last chunk of a line into the one of the previous line")
+    assert.Nil(t, testDedup.flush(), "should have nothing to summarize")
+  })
+
+  t.Run("fuzzy", func(t *testing.T) {
+    testFirstLog := &sumoLog{line: []byte("2018-01-02 10:00:01 connection 1234 refused")}
+    testSimilarLog := &sumoLog{line: []byte("2018-01-02 10:00:02 connection 1235 refused")}
+
+    testDedup := newSumoLogDedup(time.Minute, false)
+    testDedup.filter(testFirstLog, testStart)
+    assert.Equal(t, []*sumoLog{testSimilarLog}, testDedup.filter(testSimilarLog, testStart),
+      "should not collapse near-identical lines when fuzzy is disabled")
+
+    testDedup = newSumoLogDedup(time.Minute, true)
+    testDedup.filter(testFirstLog, testStart)
+    assert.Nil(t, testDedup.filter(testSimilarLog, testStart),
+      "should collapse lines differing only in numbers when fuzzy is enabled")
+    assert.NotNil(t, testDedup.flush(), "should summarize the collapsed lines")
+  })
+}
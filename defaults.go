@@ -0,0 +1,80 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strings"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+)
+
+const (
+  /* Plugin defaults are set with environment variables named after the log options,
+    e.g. SUMO_PROXY_URL for sumo-proxy-url, through `docker plugin set`. */
+  pluginDefaultsEnvPrefix = "SUMO_"
+  logOptPrefix = "sumo-"
+  /* The environment variable with the path to a JSON file of plugin defaults, mapping log options to values. */
+  pluginDefaultsFileEnv = "SUMO_DEFAULTS_FILE"
+)
+
+func envNameLogOpt(envName string) string {
+  return logOptPrefix + strings.ToLower(strings.Replace(strings.TrimPrefix(envName, pluginDefaultsEnvPrefix), "_", "-", -1))
+}
+
+/* loadPluginDefaults returns the log options set for all containers: those of the defaults file,
+  overridden by those of the environment. */
+func loadPluginDefaults() (map[string]string, error) {
+  defaults := make(map[string]string)
+  if defaultsFile := os.Getenv(pluginDefaultsFileEnv); defaultsFile != "" {
+    content, err := ioutil.ReadFile(defaultsFile)
+    if err != nil {
+      return nil, errors.Wrapf(err, "%s: failed to read defaults file", pluginName)
+    }
+    if err := json.Unmarshal(content, &defaults); err != nil {
+      return nil, errors.Wrapf(err, "%s: failed to parse defaults file %q as a JSON object of log options", pluginName, defaultsFile)
+    }
+    for logOptKey := range defaults {
+      if !strings.HasPrefix(logOptKey, logOptPrefix) {
+        return nil, fmt.Errorf("%s: defaults file %q sets %s, which is not a %s log option", pluginName, defaultsFile, logOptKey, pluginName)
+      }
+    }
+  }
+  for _, env := range os.Environ() {
+    parts := strings.SplitN(env, "=", 2)
+    if len(parts) < 2 || !strings.HasPrefix(parts[0], pluginDefaultsEnvPrefix) || parts[0] == pluginDefaultsFileEnv || parts[1] == "" {
+      continue
+    }
+    /* other SUMO_* variables of the plugin environment, e.g. SUMO_ACCESS_ID, are not log options */
+    logOptKey := envNameLogOpt(parts[0])
+    if _, exists := knownLogOpt(logOptKey); !exists {
+      continue
+    }
+    defaults[logOptKey] = parts[1]
+  }
+  return defaults, nil
+}
+
+/* mergeLogOptDefaults returns the log options with the defaults merged under them. The options setting
+  the URL are exclusive, so the default URL only applies if the log options set none of them. */
+func mergeLogOptDefaults(info logger.Info, defaults map[string]string) logger.Info {
+  if len(defaults) == 0 {
+    return info
+  }
+  hasUrl := hasLogOptUrl(info)
+  config := make(map[string]string, len(info.Config) + len(defaults))
+  for key, value := range defaults {
+    if hasUrl && isUrlLogOpt(key) {
+      continue
+    }
+    config[key] = value
+  }
+  for key, value := range info.Config {
+    config[key] = value
+  }
+  mergedInfo := info
+  mergedInfo.Config = config
+  return mergedInfo
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/stretchr/testify/assert"
+)
+
+const testDefaultsFilePath = "/tmp/sumo-defaults.json"
+
+func TestApplyPluginDefaults(t *testing.T) {
+  assert.Nil(t, ioutil.WriteFile(testDefaultsFilePath,
+    []byte(`{"sumo-proxy-url": "http://file-proxy:3128", "sumo-batch-size": "2000000", "sumo-url": "` + testHttpSourceUrl + `"}`), 0600))
+  defer os.Remove(testDefaultsFilePath)
+  os.Setenv(pluginDefaultsFileEnv, testDefaultsFilePath)
+  defer os.Unsetenv(pluginDefaultsFileEnv)
+  os.Setenv("SUMO_PROXY_URL", "http://env-proxy:3128")
+  defer os.Unsetenv("SUMO_PROXY_URL")
+  os.Setenv("SUMO_SOURCE_CATEGORY", "defaultCategory")
+  defer os.Unsetenv("SUMO_SOURCE_CATEGORY")
+  os.Setenv("SUMO_ACCESS_ID", "testAccessId")
+  defer os.Unsetenv("SUMO_ACCESS_ID")
+
+  t.Run("defaults under log options", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptSourceCategory: "testSourceCategory",
+      },
+    }
+    mergedInfo, err := resolveLogOpts(info)
+    assert.Nil(t, err)
+    assert.Equal(t, testHttpSourceUrl, mergedInfo.Config[logOptUrl], "url not specified, should be the default")
+    assert.Equal(t, "http://env-proxy:3128", mergedInfo.Config[logOptProxyUrl], "environment should override the defaults file")
+    assert.Equal(t, "2000000", mergedInfo.Config[logOptBatchSize], "batch size not specified, should be the default")
+    assert.Equal(t, "testSourceCategory", mergedInfo.Config[logOptSourceCategory], "log options should override the defaults")
+    assert.Equal(t, 1, len(info.Config), "should not modify the log options")
+    assert.NotContains(t, mergedInfo.Config, "sumo-access-id", "unrelated environment variable, should not be an option")
+    assert.Empty(t, unknownLogOpts(mergedInfo), "unrelated environment variable, should not be an unknown option")
+  })
+
+  t.Run("url options are exclusive", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrlFile: testUrlFilePath,
+      },
+    }
+    mergedInfo, err := resolveLogOpts(info)
+    assert.Nil(t, err)
+    assert.NotContains(t, mergedInfo.Config, logOptUrl, "url file specified, should not use the default url")
+    assert.Equal(t, testUrlFilePath, mergedInfo.Config[logOptUrlFile])
+  })
+
+  t.Run("bad defaults file", func(t *testing.T) {
+    for _, content := range []string{`["sumo-url"]`, `{"proxy-url": "http://proxy:3128"}`} {
+      assert.Nil(t, ioutil.WriteFile(testDefaultsFilePath, []byte(content), 0600))
+      _, err := resolveLogOpts(logger.Info{Config: map[string]string{}})
+      assert.Error(t, err, "invalid defaults file %s, should return an error", content)
+    }
+  })
+}
+
+func TestEnvNameLogOpt(t *testing.T) {
+  assert.Equal(t, logOptProxyUrl, envNameLogOpt("SUMO_PROXY_URL"))
+  assert.Equal(t, destinationLogOptKey(logOptSourceCategory, 2), envNameLogOpt("SUMO_SOURCE_CATEGORY_2"))
+}
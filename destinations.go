@@ -0,0 +1,155 @@
+package main
+
+import (
+  "fmt"
+  "io"
+  "net/url"
+
+  "github.com/docker/docker/daemon/logger"
+)
+
+const (
+  /* Additional destinations are configured with numbered log options, starting at 2:
+    sumo-url-2, sumo-compress-2, sumo-source-category-2, ... */
+  firstDestinationIndex = 2
+)
+
+/* Log options that can be set for each destination. If not set for an additional destination,
+  the value of the primary destination is used. */
+var destinationLogOpts = []string{
+  logOptUrl,
+  logOptUrlFile,
+  logOptUrlEnv,
+  logOptGzipCompression,
+  logOptGzipCompressionLevel,
+  logOptCompressCodec,
+  logOptCompressCpuBudget,
+  logOptCompressMinSize,
+  logOptSourceCategory,
+  logOptSourceName,
+  logOptSourceHost,
+  logOptQueueSize,
+  logOptFileMaxSize,
+  logOptFileMaxFiles,
+  logOptFailoverThreshold,
+  logOptFailbackInterval,
+}
+
+func destinationLogOptKey(logOptKey string, index int) string {
+  return fmt.Sprintf("%s-%d", logOptKey, index)
+}
+
+/* parseLogOptDestination returns the log options of the additional destination with the given index,
+  with the destination's own options overriding those of the primary destination. */
+func parseLogOptDestination(info logger.Info, index int) (logger.Info, bool) {
+  exists := false
+  for _, logOptKey := range urlLogOpts {
+    if _, urlExists := info.Config[destinationLogOptKey(logOptKey, index)]; urlExists {
+      exists = true
+    }
+  }
+  if !exists {
+    return info, false
+  }
+  config := make(map[string]string, len(info.Config))
+  for key, value := range info.Config {
+    config[key] = value
+  }
+  /* the URL of the destination doesn't fall back to the primary one */
+  for _, logOptKey := range urlLogOpts {
+    delete(config, logOptKey)
+  }
+  for _, logOptKey := range destinationLogOpts {
+    if value, exists := info.Config[destinationLogOptKey(logOptKey, index)]; exists {
+      config[logOptKey] = value
+    }
+  }
+  destinationInfo := info
+  destinationInfo.Config = config
+  return destinationInfo, true
+}
+
+/* newSumoDestination creates a logger holding the per-destination state: the URL, headers,
+  compression and batch queue. Logs are read and batched once, by the primary destination. */
+func newSumoDestination(info logger.Info, httpClient HttpClient, hostname string, dictionary map[string]string) (*sumoLogger, error) {
+  urlFile := info.Config[logOptUrlFile]
+  info, err := resolveLogOptUrl(info)
+  if err != nil {
+    return nil, err
+  }
+  sumoUrls := parseLogOptUrls(info, logOptUrl)
+  if len(sumoUrls) == 0 {
+    return nil, fmt.Errorf("%s: sumo-url must exist and be a valid URL", pluginName)
+  }
+  sumoUrl := sumoUrls[0]
+
+  var failover *sumoFailover
+  if len(sumoUrls) > 1 {
+    for _, failoverUrl := range sumoUrls {
+      if failoverUrl.Scheme == fileSinkScheme {
+        return nil, fmt.Errorf("%s: file URLs are not supported in a failover list", pluginName)
+      }
+    }
+    failover = newSumoFailover(sumoUrls,
+      parseLogOptIntPositive(info, logOptFailoverThreshold, defaultFailoverThreshold),
+      parseLogOptDuration(info, logOptFailbackInterval, defaultFailbackInterval))
+  }
+
+  if sumoUrl.Scheme == fileSinkScheme {
+    /* local output files are not reloaded */
+    urlFile = ""
+    /* the file path may contain {{Tag}}, so that each container gets its own file */
+    fileUrl, err := url.Parse(parseLogOptMetadata(info, logOptUrl, "", dictionary))
+    if err != nil {
+      return nil, err
+    }
+    httpClient = newFileSink(fileUrl.Path,
+      parseLogOptSize(info, logOptFileMaxSize, defaultFileMaxSizeBytes),
+      parseLogOptIntPositive(info, logOptFileMaxFiles, defaultFileMaxFiles))
+  }
+
+  queueSize := parseLogOptIntPositive(info, logOptQueueSize, defaultQueueSizeItems)
+
+  autoCompression := parseLogOptAutoCompression(info)
+  compressMinSize := defaultCompressMinSizeBytes
+  if autoCompression != nil {
+    compressMinSize = defaultAutoCompressMinSizeBytes
+  }
+  compressMinSize = parseLogOptSizeOrZero(info, logOptCompressMinSize, compressMinSize)
+  if sumoUrl.Scheme == fileSinkScheme {
+    /* an output file is a single stream, which can't be decompressed with uncompressed batches in it */
+    compressMinSize = 0
+  }
+
+  return &sumoLogger{
+    httpSourceUrl: sumoUrl.String(),
+    httpClient: httpClient,
+    failover: failover,
+    urlFile: urlFile,
+    gzipCompression: parseLogOptBoolean(info, logOptGzipCompression, defaultGzipCompression),
+    gzipCompressionLevel: parseLogOptGzipCompressionLevel(info, logOptGzipCompressionLevel, defaultGzipCompressionLevel),
+    compressCodec: parseLogOptCompressCodec(info, logOptCompressCodec, defaultCompressCodec),
+    autoCompression: autoCompression,
+    compressMinSize: compressMinSize,
+    logBatchQueue: make(chan *sumoLogBatch, queueSize),
+    info: info,
+    tag: dictionary["tag"],
+    sourceCategory: parseLogOptMetadata(info, logOptSourceCategory, "", dictionary),
+    sourceName: parseLogOptMetadata(info, logOptSourceName, info.ContainerName[1:len(info.ContainerName)], dictionary), // trim leading "/"
+    sourceHost: parseLogOptMetadata(info, logOptSourceHost, hostname, dictionary),
+  }, nil
+}
+
+func (sumoLogger *sumoLogger) closeDestinations() {
+  sumoLogger.closeHttpClient()
+  for _, destination := range sumoLogger.destinations {
+    destination.closeHttpClient()
+  }
+}
+
+/* closeHttpClient releases the client if it holds resources of its own, e.g. an output file. */
+func (sumoLogger *sumoLogger) closeHttpClient() {
+  if closer, ok := sumoLogger.httpClient.(io.Closer); ok {
+    closer.Close()
+  }
+}
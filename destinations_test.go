@@ -0,0 +1,126 @@
+package main
+
+import (
+  "context"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+  "github.com/tonistiigi/fifo"
+  "golang.org/x/sys/unix"
+)
+
+const (
+  testSecondHttpSourceUrl = "https://example.com/second"
+  testThirdHttpSourceUrl = "https://example.com/third"
+)
+
+func TestParseLogOptDestination(t *testing.T) {
+  info := logger.Info{
+    Config: map[string]string{
+      logOptUrl: testHttpSourceUrl,
+      logOptSourceCategory: "app",
+      logOptGzipCompression: "true",
+      destinationLogOptKey(logOptUrl, 2): testSecondHttpSourceUrl,
+      destinationLogOptKey(logOptSourceCategory, 2): "security",
+    },
+    ContainerID: testContainerID,
+    ContainerName: testContainerName,
+  }
+
+  destinationInfo, exists := parseLogOptDestination(info, 2)
+  assert.True(t, exists, "destination 2 is configured, should exist")
+  assert.Equal(t, testSecondHttpSourceUrl, destinationInfo.Config[logOptUrl], "should use the destination url")
+  assert.Equal(t, "security", destinationInfo.Config[logOptSourceCategory], "should use the destination option")
+  assert.Equal(t, "true", destinationInfo.Config[logOptGzipCompression], "should inherit options not set for the destination")
+  assert.Equal(t, testHttpSourceUrl, info.Config[logOptUrl], "should not modify the primary destination options")
+
+  _, exists = parseLogOptDestination(info, 3)
+  assert.False(t, exists, "destination 3 is not configured, should not exist")
+}
+
+func TestDestinations(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+
+  t.Run("NewSumoLogger with destinations", func(t *testing.T) {
+    testFifo, err := fifo.OpenFifo(context.Background(), filePath, unix.O_RDWR|unix.O_CREAT|unix.O_NONBLOCK, fileMode)
+    assert.Nil(t, err)
+    defer testFifo.Close()
+    defer os.Remove(filePath)
+
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrl: testHttpSourceUrl,
+        logOptQueueSize: "10",
+        destinationLogOptKey(logOptUrl, 2): testSecondHttpSourceUrl,
+        destinationLogOptKey(logOptGzipCompression, 2): "false",
+        destinationLogOptKey(logOptQueueSize, 2): "20",
+        destinationLogOptKey(logOptUrl, 3): testThirdHttpSourceUrl,
+        destinationLogOptKey(logOptSourceCategory, 3): "security",
+      },
+      ContainerID: testContainerID,
+      ContainerName: testContainerName,
+    }
+
+    testSumoDriver := newSumoDriver()
+    testSumoLogger, err := testSumoDriver.NewSumoLogger(filePath, info)
+    assert.Nil(t, err)
+    assert.Equal(t, testHttpSourceUrl, testSumoLogger.httpSourceUrl, "http source url should be configured correctly")
+    assert.Equal(t, 2, len(testSumoLogger.destinations), "should have two additional destinations")
+
+    testSecondDestination := testSumoLogger.destinations[0]
+    assert.Equal(t, testSecondHttpSourceUrl, testSecondDestination.httpSourceUrl, "destination url should be configured correctly")
+    assert.False(t, testSecondDestination.gzipCompression, "destination compression specified, should be specified value")
+    assert.Equal(t, 20, cap(testSecondDestination.logBatchQueue), "destination queue size specified, should be specified value")
+    assert.Equal(t, "", testSecondDestination.sourceCategory, "destination source category not specified, should be inherited")
+
+    testThirdDestination := testSumoLogger.destinations[1]
+    assert.Equal(t, testThirdHttpSourceUrl, testThirdDestination.httpSourceUrl, "destination url should be configured correctly")
+    assert.True(t, testThirdDestination.gzipCompression, "destination compression not specified, should be inherited")
+    assert.Equal(t, 10, cap(testThirdDestination.logBatchQueue), "destination queue size not specified, should be inherited")
+    assert.Equal(t, "security", testThirdDestination.sourceCategory, "destination source category specified, should be specified value")
+  })
+
+  t.Run("failing destination does not block the others", func(t *testing.T) {
+    testSumoLog := &sumoLog{
+      source: testSource,
+      line: testLine,
+      isPartial: testIsPartial,
+    }
+    testLogQueue := make(chan *sumoLog, defaultQueueSizeItems)
+    testClient := NewMockHttpClient(http.StatusOK)
+    testFailingClient := NewMockHttpClient(http.StatusServiceUnavailable)
+    testFailingDestination := &sumoLogger{
+      httpSourceUrl: testSecondHttpSourceUrl,
+      httpClient: testFailingClient,
+      logBatchQueue: make(chan *sumoLogBatch, 1),
+    }
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: testHttpSourceUrl,
+      httpClient: testClient,
+      logQueue: testLogQueue,
+      logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+      sendingInterval: 10 * time.Millisecond,
+      batchSize: defaultBatchSizeBytes,
+      destinations: []*sumoLogger{testFailingDestination},
+    }
+    go testSumoLogger.batchLogs()
+    go testSumoLogger.handleBatchedLogs()
+    go testFailingDestination.handleBatchedLogs()
+
+    testLogCount := 5
+    for i := 0; i < testLogCount; i++ {
+      testLogQueue <- testSumoLog
+      <-testClient.requestReceivedSignal
+    }
+    assert.Equal(t, testLogCount, testClient.requestCount,
+      "should have sent every batch to the healthy destination")
+    assert.True(t, testFailingClient.requestCount < testLogCount,
+      "should still be retrying the first batch on the failing destination")
+  })
+}
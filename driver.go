@@ -4,10 +4,10 @@ import (
   "compress/gzip"
   "context"
   "crypto/tls"
-  "crypto/x509"
+  "expvar"
   "fmt"
   "io"
-  "io/ioutil"
+  "math"
   "net/http"
   "net/url"
   "regexp"
@@ -28,14 +28,45 @@ const (
   /* Log options that user can set via log-opt flag when starting container. */
   /* HTTP source URL for the SumoLogic HTTP source the logs should be sent to. This option is required. */
   logOptUrl = "sumo-url"
+  /* The path to a file containing the HTTP source URL, instead of sumo-url.
+    The file is read again when it changes. */
+  logOptUrlFile = "sumo-url-file"
+  /* The name of an environment variable of the plugin containing the HTTP source URL, instead of sumo-url. */
+  logOptUrlEnv = "sumo-url-env"
+  /* How often the file set by sumo-url-file is checked for changes. */
+  logOptUrlReloadInterval = "sumo-url-reload-interval"
+  /* If set to true, the container fails to start if any log option is unknown or has an invalid value,
+    instead of falling back to the default value. */
+  logOptStrict = "sumo-strict"
+  /* The name of a profile of the profiles file, whose log options apply unless set explicitly. */
+  logOptProfile = "sumo-profile"
+  /* The path to a JSON file of profiles, mapping profile names to objects of log options. */
+  logOptProfilesFile = "sumo-profiles-file"
   /* Gzip compression. If set to true, messages will be compressed before sending to Sumo. */
   logOptGzipCompression = "sumo-compress"
   /* Gzip compression level.
-    Valid values are -1 (default), 0 (no compression), 1 (best speed) ... 9 (best compression). */
+    Valid values are -1 (default), 0 (no compression), 1 (best speed) ... 9 (best compression),
+    or auto to adapt the level to sumo-compress-cpu-budget. */
   logOptGzipCompressionLevel = "sumo-compress-level"
+  /* The percentage of one CPU a logger may spend compressing with sumo-compress-level=auto, e.g. 5%. */
+  logOptCompressCpuBudget = "sumo-compress-cpu-budget"
+  /* Batches smaller than this size are sent uncompressed. */
+  logOptCompressMinSize = "sumo-compress-min-size"
+  /* The compression codec, which sets the Content-Encoding of the requests.
+    Valid values are gzip (default), deflate and zstd. */
+  logOptCompressCodec = "sumo-compress-codec"
   /* Used for TLS configuration.
     Allows users to set a proxy URL. */
   logOptProxyUrl = "sumo-proxy-url"
+  /* Used for proxy configuration.
+    The path to a file containing the proxy credentials as user:password. */
+  logOptProxyCredentialsFile = "sumo-proxy-credentials-file"
+  /* Used for proxy configuration.
+    Comma separated list of hosts, domains and CIDR ranges that are connected to directly. */
+  logOptNoProxy = "sumo-no-proxy"
+  /* Used for proxy configuration.
+    Extra headers sent to the proxy with CONNECT requests, as a JSON object. */
+  logOptProxyConnectHeaders = "sumo-proxy-connect-headers"
   /* Used for TLS configuration.
     If set to true, TLS will not perform verification on the certificate presented by the server. */
   logOptInsecureSkipVerify = "sumo-insecure-skip-verify"
@@ -45,6 +76,28 @@ const (
   /* Used for TLS configuration.
     Allows users to specify server name with which to validate the server certificate. */
   logOptServerName = "sumo-server-name"
+  /* Used for TLS configuration.
+    Allows users to specify the path to a PEM encoded client certificate, for mutual TLS. */
+  logOptClientCertPath = "sumo-client-cert-path"
+  /* Used for TLS configuration.
+    Allows users to specify the path to the PEM encoded private key of the client certificate. */
+  logOptClientKeyPath = "sumo-client-key-path"
+  /* Used for TLS configuration.
+    The minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3. */
+  logOptTlsMinVersion = "sumo-tls-min-version"
+  /* Used for TLS configuration.
+    The maximum TLS version, one of 1.0, 1.1, 1.2 or 1.3. */
+  logOptTlsMaxVersion = "sumo-tls-max-version"
+  /* Used for TLS configuration.
+    Comma separated list of the cipher suites allowed for TLS 1.2 and below. */
+  logOptTlsCipherSuites = "sumo-tls-cipher-suites"
+  /* Used for TLS configuration.
+    Comma separated list of base64 encoded SHA-256 hashes of the Subject Public Key Info
+    of certificates the server must present one of. */
+  logOptTlsPinSha256 = "sumo-tls-pin-sha256"
+  /* Used for TLS configuration.
+    How often the root certificate and client certificate files are checked for changes, to reload them. */
+  logOptTlsReloadInterval = "sumo-tls-reload-interval"
   /* The maximum time the driver waits for number of logs to reach the batch size before sending logs,
     even if the number of logs is less than the batch size. */
   logOptSendingInterval = "sumo-sending-interval"
@@ -55,24 +108,114 @@ const (
     If the number of bytes never reaches the batch size, the driver will send the logs in smaller
     batches at predefined intervals; see sending interval. */
   logOptBatchSize = "sumo-batch-size"
+  /* The maximum number of lines in a batch, which is sent once it has that many. */
+  logOptBatchMaxLines = "sumo-batch-max-lines"
+  /* The maximum time from the first line of a batch until it's sent, even if under sumo-batch-min-size. */
+  logOptBatchMaxAge = "sumo-batch-max-age"
+  /* Batches under this size are not sent at the sending interval, but once they grow or reach sumo-batch-max-age. */
+  logOptBatchMinSize = "sumo-batch-min-size"
+  /* How lines larger than sumo-batch-size are handled: drop, truncate or split. */
+  logOptOversizeMode = "sumo-oversize-mode"
+  /* The maximum size of a log entry read from Docker, larger entries failing to be read. */
+  logOptMaxFrameSize = "sumo-max-frame-size"
+  /* Adds the time Docker read each line, so that Sumo can use it instead of the time it receives the line:
+    none, prefix to send it before the line, or json to send the line in a JSON object with it. */
+  logOptTimestamp = "sumo-timestamp"
+  /* The layout of the timestamps of sumo-timestamp: RFC3339, RFC3339Nano, RFC1123Z or a Go time layout. */
+  logOptTimestampLayout = "sumo-timestamp-layout"
+  /* Lines matching this regular expression are urgent: their batch is sent right away. */
+  logOptFlushMatch = "sumo-flush-match"
+  /* Lines of this stream, stdout or stderr, are urgent: their batch is sent right away. */
+  logOptFlushStream = "sumo-flush-stream"
+  /* The minimum time between batches sent for urgent lines. */
+  logOptFlushMinInterval = "sumo-flush-min-interval"
   /* The _sourceCategory. If empty, the category of HTTP source will be used */
   logOptSourceCategory = "sumo-source-category"
   /* The _sourceName. If empty, will be the container's name */
   logOptSourceName = "sumo-source-name"
   /* The _sourceHost. If empty, will be the machine host name */
   logOptSourceHost = "sumo-source-host"
+  /* Ordered routing rules, as a JSON array, sending matching lines to a different category or HTTP source.
+    Each rule has a "match" regular expression and/or a "stream" (stdout or stderr),
+    and a "category" and/or a "url". The first matching rule applies. */
+  logOptRoutes = "sumo-routes"
+  /* The path to a JSON file with routing rules, in the same format as sumo-routes. */
+  logOptRoutesFile = "sumo-routes-file"
+  /* Used when sumo-url is a comma separated list of failover URLs.
+    The number of consecutive failures after which traffic moves to the next URL. */
+  logOptFailoverThreshold = "sumo-failover-threshold"
+  /* Used when sumo-url is a comma separated list of failover URLs.
+    How often the primary URL is retried while failed over, to fail back once it recovers. */
+  logOptFailbackInterval = "sumo-failback-interval"
+  /* Used when sumo-url is a file:// URL.
+    The size in bytes at which the local output file is rotated. */
+  logOptFileMaxSize = "sumo-file-max-size"
+  /* Used when sumo-url is a file:// URL.
+    The number of rotated local output files to keep. */
+  logOptFileMaxFiles = "sumo-file-max-files"
+  /* If set to true, consecutive identical lines are collapsed: the first line is sent,
+    followed by a single summary line with the repeat count and time span. */
+  logOptDedup = "sumo-dedup"
+  /* The maximum time span of a run of repeated lines collapsed into one summary line. */
+  logOptDedupWindow = "sumo-dedup-window"
+  /* If set to true, lines that differ only in their numbers (timestamps, counters, ids)
+    are considered identical for deduplication. */
+  logOptDedupFuzzy = "sumo-dedup-fuzzy"
 
   defaultGzipCompression = true
   defaultGzipCompressionLevel = gzip.DefaultCompression
+  defaultCompressCodec = compressCodecGzip
+  defaultCompressCpuBudget = 0.05
+  defaultCompressMinSizeBytes = 0
+  /* with sumo-compress-level=auto, tiny batches are not worth the overhead of compression */
+  defaultAutoCompressMinSizeBytes = 1000
   defaultInsecureSkipVerify = false
+  defaultStrict = false
+
+  defaultFailoverThreshold = 3
+  defaultFailbackInterval = time.Minute
+
+  defaultFileMaxSizeBytes = 10000000
+  defaultFileMaxFiles = 5
+
+  defaultTlsReloadInterval = time.Minute
+  defaultUrlReloadInterval = time.Minute
+
+  defaultDedup = false
+  defaultDedupWindow = 10 * time.Second
+  defaultDedupFuzzy = false
 
   defaultSendingInterval = 2000 * time.Millisecond
   defaultQueueSizeItems = 100
   defaultBatchSizeBytes = 1000000
+  defaultBatchMaxLines = 0
+  defaultBatchMinSizeBytes = 0
+  /* without sumo-batch-max-age, batches held under sumo-batch-min-size are sent after this many sending intervals */
+  defaultBatchMaxAgeIntervals = 10
+  defaultFlushMinInterval = time.Second
+  defaultOversizeMode = oversizeModeDrop
+  defaultMaxFrameSizeBytes = fileReaderMaxSize
+  defaultTimestampMode = timestampModeNone
+  defaultTimestampLayout = time.RFC3339Nano
 
   fileMode = 0700
 )
 
+var sizePattern = regexp.MustCompile(`^\s*([0-9]+)\s*([a-zA-Z]*)\s*$`)
+
+var sizeUnits = map[string]int64{
+  "": 1,
+  "b": 1,
+  "kb": 1000,
+  "mb": 1000 * 1000,
+  "gb": 1000 * 1000 * 1000,
+  "kib": 1 << 10,
+  "mib": 1 << 20,
+  "gib": 1 << 30,
+}
+
+var metadataPattern = regexp.MustCompile(`(?i)\{\{(.*?)\}\}`) // needs to be a lazy match
+
 type SumoDriver interface {
   StartLogging(string, logger.Info) error
   StopLogging(string) error
@@ -90,18 +233,45 @@ type HttpClient interface {
 type sumoLogger struct {
   httpSourceUrl string
   httpClient HttpClient
+  failover *sumoFailover
+  /* the file set by sumo-url-file, if any */
+  urlFile string
+  /* guards httpSourceUrl and failover, which change when the URL file is reloaded */
+  urlMu sync.RWMutex
+  metrics *expvar.Map
+  /* closed when the logger is stopped */
+  done chan struct{}
 
   proxyUrl *url.URL
   tlsConfig *tls.Config
 
   gzipCompression bool
   gzipCompressionLevel int
+  compressCodec string
+  /* nil unless sumo-compress-level is auto */
+  autoCompression *autoCompression
+  compressMinSize int
 
   inputFile io.ReadWriteCloser
   logQueue chan *sumoLog
   logBatchQueue chan *sumoLogBatch
   sendingInterval time.Duration
   batchSize int
+  batchMaxLines int
+  /* 0 means batches are only sent at the sending interval */
+  batchMaxAge time.Duration
+  batchMinSize int
+  oversizeMode string
+  /* 0 means fileReaderMaxSize */
+  maxFrameSize int
+  timestampMode string
+  timestampLayout string
+  /* nil unless urgent lines are configured */
+  flushTrigger *sumoFlushTrigger
+  dedup *sumoLogDedup
+  routes []*sumoRoute
+  /* additional destinations, each receiving a copy of every batch */
+  destinations []*sumoLogger
 
   info logger.Info
   tag string
@@ -124,6 +294,9 @@ func (sumoDriver *sumoDriver) StartLogging(file string, info logger.Info) error
   go newSumoLogger.consumeLogsFromFile()
   go newSumoLogger.batchLogs()
   go newSumoLogger.handleBatchedLogs()
+  for _, destination := range newSumoLogger.destinations {
+    go destination.handleBatchedLogs()
+  }
   return nil
 }
 
@@ -135,9 +308,52 @@ func (sumoDriver *sumoDriver) NewSumoLogger(file string, info logger.Info) (*sum
   }
   sumoDriver.mu.Unlock()
 
-  sumoUrl := parseLogOptUrl(info, logOptUrl)
-  if sumoUrl == nil {
-    return nil, fmt.Errorf("%s: sumo-url must exist and be a valid URL", pluginName)
+  newSumoLogger, tlsReloader, err := buildSumoLogger(info)
+  if err != nil {
+    return nil, err
+  }
+  if err := createFileSinks(append([]*sumoLogger{newSumoLogger}, newSumoLogger.destinations...)); err != nil {
+    newSumoLogger.closeDestinations()
+    return nil, err
+  }
+
+  /* https://github.com/containerd/fifo */
+  inputFile, err := fifo.OpenFifo(context.Background(), file, syscall.O_RDONLY, fileMode)
+  if err != nil {
+    newSumoLogger.closeDestinations()
+    return nil, errors.Wrapf(err, "error opening logger fifo: %q", file)
+  }
+
+  newSumoLogger.inputFile = inputFile
+  newSumoLogger.metrics = newSumoMetrics(info.ContainerID)
+  for i, destination := range newSumoLogger.destinations {
+    destination.metrics = newSumoMetrics(destinationMetricsName(info.ContainerID, firstDestinationIndex + i))
+  }
+  newSumoLogger.done = make(chan struct{})
+
+  if tlsReloader != nil {
+    go watchFiles(newSumoLogger.done, parseLogOptDuration(info, logOptTlsReloadInterval, defaultTlsReloadInterval),
+      tlsReloader.paths(), tlsReloader.reload)
+  }
+  for _, destination := range append([]*sumoLogger{newSumoLogger}, newSumoLogger.destinations...) {
+    if destination.urlFile != "" {
+      go watchFiles(newSumoLogger.done, parseLogOptDuration(info, logOptUrlReloadInterval, defaultUrlReloadInterval),
+        []string{destination.urlFile}, destination.reloadUrl)
+    }
+  }
+
+  sumoDriver.mu.Lock()
+  sumoDriver.loggers[file] = newSumoLogger
+  sumoDriver.mu.Unlock()
+
+  return newSumoLogger, nil
+}
+
+/* buildSumoLogger parses the log options into a logger and its destinations, without opening the fifo or
+  the output files, or starting any goroutine, so that the options can also be checked outside of Docker. */
+func buildSumoLogger(info logger.Info) (*sumoLogger, *tlsReloader, error) {
+  if err := validateLogOpts(info); err != nil {
+    return nil, nil, err
   }
 
   hostname, err := info.Hostname()
@@ -147,79 +363,106 @@ func (sumoDriver *sumoDriver) NewSumoLogger(file string, info logger.Info) (*sum
 
   tag, err := loggerutils.ParseLogTag(info, loggerutils.DefaultTemplate)
   if err != nil {
-    return nil, err
+    return nil, nil, err
   }
 
   dictionary := map[string]string {
     "tag": tag,
   }
 
-  sourceCategory := parseLogOptMetadata(info, logOptSourceCategory, "", dictionary)
-  sourceName := parseLogOptMetadata(info, logOptSourceName, info.ContainerName[1:len(info.ContainerName)], dictionary) // trim leading "/"
-  sourceHost := parseLogOptMetadata(info, logOptSourceHost, hostname, dictionary)
-
-  gzipCompression := parseLogOptBoolean(info, logOptGzipCompression, defaultGzipCompression)
-  gzipCompressionLevel := parseLogOptGzipCompressionLevel(info, logOptGzipCompressionLevel, defaultGzipCompressionLevel)
-
-  tlsConfig := &tls.Config{}
-  tlsConfig.InsecureSkipVerify = parseLogOptBoolean(info, logOptInsecureSkipVerify, defaultInsecureSkipVerify)
-  if rootCaPath, exists := info.Config[logOptRootCaPath]; exists {
-    rootCa, err := ioutil.ReadFile(rootCaPath)
-    if err != nil {
-      return nil, err
-    }
-    rootCaPool := x509.NewCertPool()
-    rootCaPool.AppendCertsFromPEM(rootCa)
-    tlsConfig.RootCAs = rootCaPool
+  tlsConfig, err := parseLogOptTlsConfig(info)
+  if err != nil {
+    return nil, nil, err
   }
-  if serverName, exists := info.Config[logOptServerName]; exists {
-    tlsConfig.ServerName = serverName
+
+  proxyUrl := parseLogOptUrl(info, logOptProxyUrl)
+  sumoProxy, err := parseLogOptProxy(info, proxyUrl)
+  if err != nil {
+    return nil, nil, err
   }
 
   transport := &http.Transport{}
-  proxyUrl := parseLogOptUrl(info, logOptProxyUrl)
-  transport.Proxy = http.ProxyURL(proxyUrl)
+  sumoProxy.configure(transport)
   transport.TLSClientConfig = tlsConfig
 
+  var roundTripper http.RoundTripper = transport
+  tlsReloader := newTlsReloader(info, transport)
+  if tlsReloader != nil {
+    roundTripper = tlsReloader
+  }
+
   httpClient := &http.Client{
-    Transport: transport,
+    Transport: roundTripper,
     Timeout: 30 * time.Second,
   }
 
+  newSumoLogger, err := newSumoDestination(info, httpClient, hostname, dictionary)
+  if err != nil {
+    return nil, nil, err
+  }
+  for i := firstDestinationIndex; ; i++ {
+    destinationInfo, exists := parseLogOptDestination(info, i)
+    if !exists {
+      break
+    }
+    destination, err := newSumoDestination(destinationInfo, httpClient, hostname, dictionary)
+    if err != nil {
+      newSumoLogger.closeDestinations()
+      return nil, nil, errors.Wrapf(err, "error configuring destination %d", i)
+    }
+    newSumoLogger.destinations = append(newSumoLogger.destinations, destination)
+  }
+
   sendingInterval := parseLogOptDuration(info, logOptSendingInterval, defaultSendingInterval)
   queueSize := parseLogOptIntPositive(info, logOptQueueSize, defaultQueueSizeItems)
-  batchSize := parseLogOptIntPositive(info, logOptBatchSize, defaultBatchSizeBytes)
+  batchSize := parseLogOptSize(info, logOptBatchSize, defaultBatchSizeBytes)
+  batchMaxLines := parseLogOptIntOrZero(info, logOptBatchMaxLines, defaultBatchMaxLines)
+  batchMinSize := parseLogOptSizeOrZero(info, logOptBatchMinSize, defaultBatchMinSizeBytes)
+  var defaultBatchMaxAge time.Duration
+  if batchMinSize > 0 {
+    defaultBatchMaxAge = defaultBatchMaxAgeIntervals * sendingInterval
+  }
+  batchMaxAge := parseLogOptDuration(info, logOptBatchMaxAge, defaultBatchMaxAge)
+  oversizeMode := parseLogOptOversizeMode(info, logOptOversizeMode, defaultOversizeMode)
+  maxFrameSize := parseLogOptSize(info, logOptMaxFrameSize, defaultMaxFrameSizeBytes)
+  timestampMode := parseLogOptTimestampMode(info, logOptTimestamp, defaultTimestampMode)
+  timestampLayout := parseLogOptTimestampLayout(info, logOptTimestampLayout, defaultTimestampLayout)
+
+  var dedup *sumoLogDedup
+  if parseLogOptBoolean(info, logOptDedup, defaultDedup) {
+    dedup = newSumoLogDedup(
+      parseLogOptDuration(info, logOptDedupWindow, defaultDedupWindow),
+      parseLogOptBoolean(info, logOptDedupFuzzy, defaultDedupFuzzy))
+  }
 
-  /* https://github.com/containerd/fifo */
-  inputFile, err := fifo.OpenFifo(context.Background(), file, syscall.O_RDONLY, fileMode)
+  routes, err := parseLogOptRoutes(info, dictionary)
   if err != nil {
-    return nil, errors.Wrapf(err, "error opening logger fifo: %q", file)
+    newSumoLogger.closeDestinations()
+    return nil, nil, err
   }
 
-  newSumoLogger := &sumoLogger{
-    httpSourceUrl: sumoUrl.String(),
-    httpClient: httpClient,
-    proxyUrl: proxyUrl,
-    tlsConfig: tlsConfig,
-    inputFile: inputFile,
-    gzipCompression: gzipCompression,
-    gzipCompressionLevel: gzipCompressionLevel,
-    logQueue: make(chan *sumoLog, 10 * queueSize),
-    logBatchQueue: make(chan *sumoLogBatch, queueSize),
-    sendingInterval: sendingInterval,
-    batchSize: batchSize,
-    info: info,
-    tag: tag,
-    sourceCategory: sourceCategory,
-    sourceName: sourceName,
-    sourceHost: sourceHost,
+  flushTrigger, err := parseLogOptFlushTrigger(info)
+  if err != nil {
+    newSumoLogger.closeDestinations()
+    return nil, nil, err
   }
 
-  sumoDriver.mu.Lock()
-  sumoDriver.loggers[file] = newSumoLogger
-  sumoDriver.mu.Unlock()
-
-  return newSumoLogger, nil
+  newSumoLogger.proxyUrl = proxyUrl
+  newSumoLogger.tlsConfig = tlsConfig
+  newSumoLogger.logQueue = make(chan *sumoLog, 10 * queueSize)
+  newSumoLogger.sendingInterval = sendingInterval
+  newSumoLogger.batchSize = batchSize
+  newSumoLogger.batchMaxLines = batchMaxLines
+  newSumoLogger.batchMaxAge = batchMaxAge
+  newSumoLogger.batchMinSize = batchMinSize
+  newSumoLogger.oversizeMode = oversizeMode
+  newSumoLogger.maxFrameSize = maxFrameSize
+  newSumoLogger.timestampMode = timestampMode
+  newSumoLogger.timestampLayout = timestampLayout
+  newSumoLogger.dedup = dedup
+  newSumoLogger.routes = routes
+  newSumoLogger.flushTrigger = flushTrigger
+  return newSumoLogger, tlsReloader, nil
 }
 
 func (sumoDriver *sumoDriver) StopLogging(file string) error {
@@ -228,6 +471,11 @@ func (sumoDriver *sumoDriver) StopLogging(file string) error {
   if exists {
     logrus.Debug(fmt.Sprintf("%s: Stopping logging driver for closed container.", pluginName))
     sumoLogger.inputFile.Close()
+    close(sumoLogger.done)
+    deleteSumoMetrics(sumoLogger.info.ContainerID)
+    for i := range sumoLogger.destinations {
+      deleteSumoMetrics(destinationMetricsName(sumoLogger.info.ContainerID, i + firstDestinationIndex))
+    }
     delete(sumoDriver.loggers, file)
   }
   sumoDriver.mu.Unlock()
@@ -253,24 +501,41 @@ func interpretAll(re *regexp.Regexp, input string, dictionary map[string]string)
 
 func parseLogOptMetadata(info logger.Info, logOptKey string, defaultValue string, dictionary map[string]string) string {
   if input, exists := info.Config[logOptKey]; exists {
-    re := regexp.MustCompile(`(?i)\{\{(.*?)\}\}`) // needs to be a lazy match
-    return interpretAll(re, input, dictionary)
+    return interpretAll(metadataPattern, input, dictionary)
   }
   return defaultValue
 }
 
 func parseLogOptIntPositive(info logger.Info, logOptKey string, defaultValue int) int {
   if input, exists := info.Config[logOptKey]; exists {
-    inputValue64, err := strconv.ParseInt(input, stringToIntBase, stringToIntBitSize)
+    inputValue, err := parseIntPositive(logOptKey, input)
     if err != nil {
-      logrus.Error(fmt.Errorf("%s: Failed to parse value of %s as integer. Using default %d. %v",
-        pluginName, logOptKey, defaultValue, err))
+      logrus.Error(fmt.Errorf("%s: %v. Using default %d", pluginName, err, defaultValue))
       return defaultValue
     }
-    inputValue := int(inputValue64)
-    if inputValue <= 0 {
-      logrus.Error(fmt.Errorf("%s: %s must be a positive value, got %d. Using default %d",
-        pluginName, logOptKey, inputValue, defaultValue))
+    return inputValue
+  }
+  return defaultValue
+}
+
+func parseIntPositive(logOptKey string, input string) (int, error) {
+  inputValue64, err := strconv.ParseInt(input, stringToIntBase, stringToIntBitSize)
+  if err != nil {
+    return 0, fmt.Errorf("Failed to parse value of %s as integer. %v", logOptKey, err)
+  }
+  inputValue := int(inputValue64)
+  if inputValue <= 0 {
+    return 0, fmt.Errorf("%s must be a positive value, got %d", logOptKey, inputValue)
+  }
+  return inputValue, nil
+}
+
+/* parseLogOptIntOrZero parses an integer as parseLogOptIntPositive does, also accepting 0, which disables the threshold it sets. */
+func parseLogOptIntOrZero(info logger.Info, logOptKey string, defaultValue int) int {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseIntOrZero(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %d", pluginName, err, defaultValue))
       return defaultValue
     }
     return inputValue
@@ -278,18 +543,75 @@ func parseLogOptIntPositive(info logger.Info, logOptKey string, defaultValue int
   return defaultValue
 }
 
-func parseLogOptDuration(info logger.Info, logOptKey string, defaultValue time.Duration) time.Duration {
+func parseIntOrZero(logOptKey string, input string) (int, error) {
+  if inputValue64, err := strconv.ParseInt(input, stringToIntBase, stringToIntBitSize); err == nil && inputValue64 == 0 {
+    return 0, nil
+  }
+  return parseIntPositive(logOptKey, input)
+}
+
+/* parseLogOptSize parses a positive number of bytes, optionally with a unit, e.g. 2MB or 512KiB. */
+func parseLogOptSize(info logger.Info, logOptKey string, defaultValue int) int {
   if input, exists := info.Config[logOptKey]; exists {
-    inputValue, err := time.ParseDuration(input)
+    inputValue, err := parseSize(logOptKey, input)
     if err != nil {
-      logrus.Error(fmt.Errorf("%s: Failed to parse value of %s as duration. Using default %v. %v",
-        pluginName, logOptKey, defaultValue, err))
+      logrus.Error(fmt.Errorf("%s: %v. Using default %d", pluginName, err, defaultValue))
       return defaultValue
     }
-    zeroSeconds, _ := time.ParseDuration("0s")
-    if inputValue <= zeroSeconds {
-      logrus.Error(fmt.Errorf("%s: %s must be a positive duration, got %s. Using default %s",
-        pluginName, logOptKey, inputValue.String(), defaultValue.String()))
+    return inputValue
+  }
+  return defaultValue
+}
+
+func parseSize(logOptKey string, input string) (int, error) {
+  groups := sizePattern.FindStringSubmatch(input)
+  if groups == nil {
+    return 0, fmt.Errorf("Failed to parse value of %s as size, got '%s' (e.g. 2000000, 2MB or 512KiB)", logOptKey, input)
+  }
+  multiplier, exists := sizeUnits[strings.ToLower(groups[2])]
+  if !exists {
+    return 0, fmt.Errorf("Not supported unit '%s' for %s (supported units are B, KB, MB, GB, KiB, MiB and GiB)",
+      groups[2], logOptKey)
+  }
+  inputValue64, err := strconv.ParseInt(groups[1], stringToIntBase, stringToIntBitSize)
+  if err != nil || inputValue64 > math.MaxInt32 / multiplier {
+    return 0, fmt.Errorf("Failed to parse value of %s as size, got '%s'", logOptKey, input)
+  }
+  inputValue := int(inputValue64 * multiplier)
+  if inputValue <= 0 {
+    return 0, fmt.Errorf("%s must be a positive size, got %d", logOptKey, inputValue)
+  }
+  return inputValue, nil
+}
+
+/* parseLogOptSizeOrZero parses a size as parseLogOptSize does, also accepting 0, which disables the threshold it sets. */
+func parseLogOptSizeOrZero(info logger.Info, logOptKey string, defaultValue int) int {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseSizeOrZero(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %d", pluginName, err, defaultValue))
+      return defaultValue
+    }
+    return inputValue
+  }
+  return defaultValue
+}
+
+func parseSizeOrZero(logOptKey string, input string) (int, error) {
+  if groups := sizePattern.FindStringSubmatch(input); groups != nil {
+    _, knownUnit := sizeUnits[strings.ToLower(groups[2])]
+    if inputValue64, err := strconv.ParseInt(groups[1], stringToIntBase, stringToIntBitSize); err == nil && inputValue64 == 0 && knownUnit {
+      return 0, nil
+    }
+  }
+  return parseSize(logOptKey, input)
+}
+
+func parseLogOptDuration(info logger.Info, logOptKey string, defaultValue time.Duration) time.Duration {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseDurationPositive(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %v", pluginName, err, defaultValue))
       return defaultValue
     }
     return inputValue
@@ -297,12 +619,22 @@ func parseLogOptDuration(info logger.Info, logOptKey string, defaultValue time.D
   return defaultValue
 }
 
+func parseDurationPositive(logOptKey string, input string) (time.Duration, error) {
+  inputValue, err := time.ParseDuration(input)
+  if err != nil {
+    return 0, fmt.Errorf("Failed to parse value of %s as duration. %v", logOptKey, err)
+  }
+  if inputValue <= 0 {
+    return 0, fmt.Errorf("%s must be a positive duration, got %s", logOptKey, inputValue.String())
+  }
+  return inputValue, nil
+}
+
 func parseLogOptBoolean(info logger.Info, logOptKey string, defaultValue bool) bool {
   if input, exists := info.Config[logOptKey]; exists {
-    inputValue, err := strconv.ParseBool(input)
+    inputValue, err := parseBoolean(logOptKey, input)
     if err != nil {
-      logrus.Error(fmt.Errorf("%s: Failed to parse value of %s as boolean. Using default %t. %v",
-        pluginName, logOptKey, defaultValue, err))
+      logrus.Error(fmt.Errorf("%s: %v. Using default %t", pluginName, err, defaultValue))
       return defaultValue
     }
     return inputValue
@@ -310,12 +642,20 @@ func parseLogOptBoolean(info logger.Info, logOptKey string, defaultValue bool) b
   return defaultValue
 }
 
+func parseBoolean(logOptKey string, input string) (bool, error) {
+  inputValue, err := strconv.ParseBool(input)
+  if err != nil {
+    return false, fmt.Errorf("Failed to parse value of %s as boolean. %v", logOptKey, err)
+  }
+  return inputValue, nil
+}
+
 func parseLogOptUrl(info logger.Info, logOptKey string) *url.URL {
   if input, exists := info.Config[logOptKey]; exists {
     inputValue, err := url.Parse(input)
     if err != nil {
       logrus.Error(fmt.Errorf("%s: Failed to parse value of %s as url. %v",
-        pluginName, logOptKey, err))
+        pluginName, logOptKey, redactUrlError(err)))
       return nil
     }
     return inputValue
@@ -324,21 +664,26 @@ func parseLogOptUrl(info logger.Info, logOptKey string) *url.URL {
 }
 
 func parseLogOptGzipCompressionLevel(info logger.Info, logOptKey string, defaultValue int) int {
-  if input, exists := info.Config[logOptKey]; exists {
-    inputValue64, err := strconv.ParseInt(input, stringToIntBase, stringToIntBitSize)
+  if input, exists := info.Config[logOptKey]; exists && !isAutoCompressionLevel(input) {
+    inputValue, err := parseGzipCompressionLevel(logOptKey, input)
     if err != nil {
-      logrus.Error(fmt.Errorf("%s: Failed to parse value of %s as integer. Using default %d. %v",
-        pluginName, logOptKey, defaultValue, err))
-      return defaultValue
-    }
-    inputValue := int(inputValue64)
-    if inputValue < defaultValue || inputValue > gzip.BestCompression {
-      logrus.Error(fmt.Errorf(
-        "%s: Not supported level '%d' for %s (supported values between %d and %d). Using default compression",
-        pluginName, inputValue, logOptKey, defaultValue, gzip.BestCompression))
+      logrus.Error(fmt.Errorf("%s: %v. Using default compression", pluginName, err))
       return defaultValue
     }
     return inputValue
   }
   return defaultValue
 }
+
+func parseGzipCompressionLevel(logOptKey string, input string) (int, error) {
+  inputValue64, err := strconv.ParseInt(input, stringToIntBase, stringToIntBitSize)
+  if err != nil {
+    return 0, fmt.Errorf("Failed to parse value of %s as integer. %v", logOptKey, err)
+  }
+  inputValue := int(inputValue64)
+  if inputValue < gzip.DefaultCompression || inputValue > gzip.BestCompression {
+    return 0, fmt.Errorf("Not supported level '%d' for %s (supported values between %d and %d)",
+      inputValue, logOptKey, gzip.DefaultCompression, gzip.BestCompression)
+  }
+  return inputValue, nil
+}
@@ -70,10 +70,13 @@ func TestDriversDefaultConfig (t *testing.T) {
     assert.Equal(t, defaultSendingInterval, testSumoLogger1.sendingInterval, "sending interval not specified, should be default value")
     assert.Equal(t, defaultQueueSizeItems, cap(testSumoLogger1.logBatchQueue), "queue size not specified, should be default value")
     assert.Equal(t, defaultBatchSizeBytes, testSumoLogger1.batchSize, "batch size not specified, should be default value")
+    assert.Equal(t, defaultBatchMaxLines, testSumoLogger1.batchMaxLines, "max lines not specified, should be default value")
+    assert.Equal(t, time.Duration(0), testSumoLogger1.batchMaxAge, "max age and min size not specified, should be disabled")
     assert.Equal(t, &tls.Config{}, testSumoLogger1.tlsConfig, "tls configs not specified, should be default value")
     assert.Nil(t, testSumoLogger1.proxyUrl, "proxy url not specified, should be default value")
     assert.Equal(t, testContainerID[:12], testSumoLogger1.tag, "tag not specified, should be default value")
     assert.Equal(t, "test_container_name", testSumoLogger1.sourceName, "source name not specified, should be default value")
+    assert.Nil(t, testSumoLogger1.dedup, "dedup not specified, should be disabled")
 
     _, err = testSumoDriver.NewSumoLogger(filePath1, info)
     assert.Error(t, err, "trying to call StartLogging for filepath that already exists should return error")
@@ -191,6 +194,96 @@ func TestDriversLogOpts (t *testing.T) {
     assert.Equal(t, testTlsConfig, testSumoLogger.tlsConfig, "tls config options specified, should be specified value")
   })
 
+  t.Run("NewSumoLogger with dedup", func(t *testing.T) {
+    testDedupWindow := time.Minute
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrl: testHttpSourceUrl,
+        logOptDedup: "true",
+        logOptDedupWindow: testDedupWindow.String(),
+        logOptDedupFuzzy: "true",
+      },
+      ContainerID: testContainerID,
+      ContainerName: testContainerName,
+    }
+
+    testSumoDriver := newSumoDriver()
+    testSumoLogger, err := testSumoDriver.NewSumoLogger(filePath, info)
+    assert.Nil(t, err)
+    assert.NotNil(t, testSumoLogger.dedup, "dedup specified, should be enabled")
+    assert.Equal(t, testDedupWindow, testSumoLogger.dedup.window, "dedup window specified, should be specified value")
+    assert.True(t, testSumoLogger.dedup.fuzzy, "dedup fuzzy specified, should be specified value")
+  })
+
+  t.Run("NewSumoLogger with batch thresholds", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrl: testHttpSourceUrl,
+        logOptSendingInterval: "1s",
+        logOptBatchMaxLines: "500",
+        logOptBatchMinSize: "10KB",
+      },
+      ContainerID: testContainerID,
+      ContainerName: testContainerName,
+    }
+
+    testSumoDriver := newSumoDriver()
+    testSumoLogger, err := testSumoDriver.NewSumoLogger(filePath, info)
+    assert.Nil(t, err)
+    assert.Equal(t, 500, testSumoLogger.batchMaxLines, "max lines specified, should be specified value")
+    assert.Equal(t, 10000, testSumoLogger.batchMinSize, "min size specified, should be specified value")
+    assert.Equal(t, 10 * time.Second, testSumoLogger.batchMaxAge,
+      "min size specified without max age, should be 10 sending intervals")
+    testSumoDriver.StopLogging(filePath)
+
+    info.Config[logOptBatchMaxAge] = "3s"
+    testSumoLogger, err = testSumoDriver.NewSumoLogger(filePath, info)
+    assert.Nil(t, err)
+    assert.Equal(t, 3 * time.Second, testSumoLogger.batchMaxAge, "max age specified, should be specified value")
+    testSumoDriver.StopLogging(filePath)
+
+    delete(info.Config, logOptBatchMaxAge)
+    info.Config[logOptStrict] = "true"
+    info.Config[logOptBatchMaxLines] = "0"
+    info.Config[logOptBatchMinSize] = "0"
+    testSumoLogger, err = testSumoDriver.NewSumoLogger(filePath, info)
+    assert.Nil(t, err, "zero thresholds, should pass strict validation")
+    assert.Equal(t, 0, testSumoLogger.batchMaxLines, "zero max lines, should be disabled")
+    assert.Equal(t, 0, testSumoLogger.batchMinSize, "zero min size, should be disabled")
+    assert.Equal(t, time.Duration(0), testSumoLogger.batchMaxAge, "min size disabled, should have no max age")
+    testSumoDriver.StopLogging(filePath)
+
+    info.Config[logOptBatchMaxLines] = "-1"
+    _, err = testSumoDriver.NewSumoLogger(filePath, info)
+    assert.NotNil(t, err, "negative max lines, should fail strict validation")
+  })
+
+  t.Run("NewSumoLogger with file url", func(t *testing.T) {
+    defer os.RemoveAll(testFileSinkDir)
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrl: "file://" + testFileSinkDir + "/{{Tag}}.log",
+        logOptFileMaxSize: "1000",
+        logOptFileMaxFiles: "3",
+      },
+      ContainerID: testContainerID,
+      ContainerName: testContainerName,
+    }
+
+    testSumoDriver := newSumoDriver()
+    testSumoLogger, err := testSumoDriver.NewSumoLogger(filePath, info)
+    assert.Nil(t, err)
+    testFileSink, ok := testSumoLogger.httpClient.(*fileSink)
+    assert.True(t, ok, "file url specified, should write to a local file")
+    assert.Equal(t, testFileSinkDir + "/" + testContainerID[:12] + ".log", testFileSink.path,
+      "file url specified, should interpret the tag in the file path")
+    assert.Equal(t, 1000, testFileSink.maxSize, "file max size specified, should be specified value")
+    assert.Equal(t, 3, testFileSink.maxFiles, "file max files specified, should be specified value")
+    _, err = os.Stat(testFileSink.path)
+    assert.Nil(t, err, "should create the file when the container starts")
+    testFileSink.Close()
+  })
+
   t.Run("NewSumoLogger with bad insecure skip verify", func(t *testing.T) {
     info := logger.Info{
       Config: map[string]string{
@@ -0,0 +1,161 @@
+package main
+
+import (
+  "fmt"
+  "net/url"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  /* Separates the ordered failover URLs in sumo-url. */
+  failoverUrlSeparator = ","
+)
+
+type sumoEndpoint struct {
+  index int
+  url *url.URL
+  consecutiveFailures int
+  lastFailure time.Time
+  lastSuccess time.Time
+  /* whether the last failure can't be fixed by retrying the endpoint, e.g. a certificate not matching the pins */
+  permanentFailure bool
+}
+
+/* sumoFailover tracks the health of an ordered list of endpoints. Traffic moves to the next endpoint
+  after a number of consecutive failures, and goes back to the primary once it accepts a batch again. */
+type sumoFailover struct {
+  endpoints []*sumoEndpoint
+  active int
+  threshold int
+  failbackInterval time.Duration
+  lastFailbackAttempt time.Time
+  mu sync.Mutex
+}
+
+func newSumoFailover(urls []*url.URL, threshold int, failbackInterval time.Duration) *sumoFailover {
+  failover := &sumoFailover{
+    threshold: threshold,
+    failbackInterval: failbackInterval,
+  }
+  for i, endpointUrl := range urls {
+    failover.endpoints = append(failover.endpoints, &sumoEndpoint{
+      index: i,
+      url: endpointUrl,
+    })
+  }
+  return failover
+}
+
+/* endpoint returns the endpoint to send the next batch to: the active endpoint,
+  or the primary once per failback interval while failed over, to probe whether it recovered. */
+func (failover *sumoFailover) endpoint(now time.Time) *sumoEndpoint {
+  failover.mu.Lock()
+  defer failover.mu.Unlock()
+  if failover.active != 0 && now.Sub(failover.lastFailbackAttempt) >= failover.failbackInterval {
+    failover.lastFailbackAttempt = now
+    return failover.endpoints[0]
+  }
+  return failover.endpoints[failover.active]
+}
+
+/* report records the result of sending to the endpoint. If the result caused a switch,
+  it returns the endpoint traffic was switched from, and whether the switch was a failback to the primary. */
+func (failover *sumoFailover) report(endpoint *sumoEndpoint, err error, now time.Time) (*sumoEndpoint, bool) {
+  failover.mu.Lock()
+  defer failover.mu.Unlock()
+  previous := failover.endpoints[failover.active]
+  if err == nil {
+    endpoint.consecutiveFailures = 0
+    endpoint.permanentFailure = false
+    endpoint.lastSuccess = now
+    if endpoint.index == 0 && failover.active != 0 {
+      failover.active = 0
+      return previous, true
+    }
+    return nil, false
+  }
+  endpoint.consecutiveFailures++
+  endpoint.lastFailure = now
+  endpoint.permanentFailure = isPermanentError(err)
+  if endpoint != previous || endpoint.consecutiveFailures < failover.threshold {
+    return nil, false
+  }
+  failover.active = (failover.active + 1) % len(failover.endpoints)
+  failover.endpoints[failover.active].consecutiveFailures = 0
+  failover.lastFailbackAttempt = now
+  return previous, false
+}
+
+/* failedPermanently returns whether the last attempt on every endpoint failed in a way retrying can't fix. */
+func (failover *sumoFailover) failedPermanently() bool {
+  failover.mu.Lock()
+  defer failover.mu.Unlock()
+  for _, endpoint := range failover.endpoints {
+    if !endpoint.permanentFailure {
+      return false
+    }
+  }
+  return true
+}
+
+func (failover *sumoFailover) activeEndpoint() *sumoEndpoint {
+  failover.mu.Lock()
+  defer failover.mu.Unlock()
+  return failover.endpoints[failover.active]
+}
+
+/* sendToEndpoint sends the payload to the endpoint chosen by the failover list, and records the result.
+  An error retrying can't fix is only returned as such once every endpoint failed with one, so that
+  the batch is retried, failing over to the next endpoints as for any other error, before it's dropped. */
+func (sumoLogger *sumoLogger) sendToEndpoint(failover *sumoFailover, send func(httpSourceUrl string) error) error {
+  now := time.Now()
+  endpoint := failover.endpoint(now)
+  err := send(endpoint.url.String())
+  previous, failback := failover.report(endpoint, err, now)
+  if isPermanentError(err) && !failover.failedPermanently() {
+    err = fmt.Errorf("%v", err)
+  }
+  if previous == nil {
+    return err
+  }
+  active := failover.activeEndpoint()
+  if failback {
+    logrus.Info(fmt.Sprintf("%s: Failing back from endpoint %d (%s) to primary endpoint (%s)",
+      pluginName, previous.index + 1, previous.url.Host, active.url.Host))
+    sumoLogger.addMetric(metricFailbacks, 1)
+  } else {
+    logrus.Warn(fmt.Sprintf("%s: Failing over from endpoint %d (%s) to endpoint %d (%s) after %d consecutive failures",
+      pluginName, previous.index + 1, previous.url.Host, active.index + 1, active.url.Host, previous.consecutiveFailures))
+    sumoLogger.addMetric(metricFailovers, 1)
+  }
+  sumoLogger.setMetric(metricActiveEndpoint, int64(active.index + 1))
+  return err
+}
+
+/* parseLogOptUrls parses an ordered, comma separated list of URLs. */
+func parseLogOptUrls(info logger.Info, logOptKey string) []*url.URL {
+  input, exists := info.Config[logOptKey]
+  if !exists {
+    return nil
+  }
+  return parseUrls(input, logOptKey)
+}
+
+func parseUrls(input string, logOptKey string) []*url.URL {
+  var urls []*url.URL
+  for _, urlStr := range strings.Split(input, failoverUrlSeparator) {
+    inputValue, err := url.Parse(strings.TrimSpace(urlStr))
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: Failed to parse value of %s as url. %v",
+        pluginName, logOptKey, redactUrlError(err)))
+      return nil
+    }
+    urls = append(urls, inputValue)
+  }
+  return urls
+}
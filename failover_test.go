@@ -0,0 +1,159 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "sync"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+const (
+  testPrimaryHttpSourceUrl = "https://primary.example.org/receiver"
+  testSecondaryHttpSourceUrl = "https://secondary.example.org/receiver"
+)
+
+type mockEndpointsHttpClient struct {
+  statusCodes map[string]int
+  errs map[string]error
+  requestCounts map[string]int
+  mu sync.Mutex
+}
+
+func (m *mockEndpointsHttpClient) Do(req *http.Request) (*http.Response, error) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.requestCounts[req.URL.Host] += 1
+  if err := m.errs[req.URL.Host]; err != nil {
+    return nil, err
+  }
+  return &http.Response{
+      Body: ioutil.NopCloser(bytes.NewBuffer([]byte("mock response for testing"))),
+      StatusCode: m.statusCodes[req.URL.Host],
+    }, nil
+}
+
+func (m *mockEndpointsHttpClient) setStatusCode(host string, statusCode int) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.statusCodes[host] = statusCode
+}
+
+func (m *mockEndpointsHttpClient) setError(host string, err error) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.errs[host] = err
+}
+
+func NewMockEndpointsHttpClient() *mockEndpointsHttpClient {
+  return &mockEndpointsHttpClient{
+    statusCodes: map[string]int{
+      "primary.example.org": http.StatusOK,
+      "secondary.example.org": http.StatusOK,
+    },
+    errs: make(map[string]error),
+    requestCounts: make(map[string]int),
+  }
+}
+
+func TestParseLogOptUrls(t *testing.T) {
+  info := logger.Info{
+    Config: map[string]string{
+      logOptUrl: testPrimaryHttpSourceUrl + ", " + testSecondaryHttpSourceUrl,
+    },
+  }
+  urls := parseLogOptUrls(info, logOptUrl)
+  assert.Equal(t, 2, len(urls), "should parse every url in the list")
+  assert.Equal(t, testPrimaryHttpSourceUrl, urls[0].String(), "should keep the order of the list")
+  assert.Equal(t, testSecondaryHttpSourceUrl, urls[1].String(), "should keep the order of the list")
+}
+
+func TestFailover(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  testPrimaryUrl, _ := url.Parse(testPrimaryHttpSourceUrl)
+  testSecondaryUrl, _ := url.Parse(testSecondaryHttpSourceUrl)
+  testLogs := []*sumoLog{{source: testSource, line: testLine}}
+  testThreshold := 3
+
+  testClient := NewMockEndpointsHttpClient()
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: testPrimaryHttpSourceUrl,
+    httpClient: testClient,
+    failover: newSumoFailover([]*url.URL{testPrimaryUrl, testSecondaryUrl}, testThreshold, 100 * time.Millisecond),
+    metrics: newSumoMetrics(t.Name()),
+  }
+  defer deleteSumoMetrics(t.Name())
+
+  t.Run("primary healthy", func(t *testing.T) {
+    assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should be no errors sending logs")
+    assert.Equal(t, 1, testClient.requestCounts["primary.example.org"], "should have sent to the primary")
+    assert.Equal(t, 0, testClient.requestCounts["secondary.example.org"], "should not have sent to the secondary")
+  })
+
+  t.Run("primary failing", func(t *testing.T) {
+    testClient.setStatusCode("primary.example.org", http.StatusServiceUnavailable)
+    for i := 0; i < testThreshold; i++ {
+      assert.NotNil(t, testSumoLogger.sendLogs(testLogs), "should be an error sending logs")
+    }
+    assert.Equal(t, 1, testSumoLogger.failover.activeEndpoint().index, "should have failed over to the secondary")
+    assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should be no errors sending logs")
+    assert.Equal(t, 1 + testThreshold, testClient.requestCounts["primary.example.org"], "should not have sent to the primary")
+    assert.Equal(t, 1, testClient.requestCounts["secondary.example.org"], "should have sent to the secondary")
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricFailovers).String(), "should have counted the failover")
+    assert.Equal(t, "2", testSumoLogger.metrics.Get(metricActiveEndpoint).String(), "should expose the active endpoint")
+  })
+
+  t.Run("primary still failing", func(t *testing.T) {
+    time.Sleep(100 * time.Millisecond)
+    assert.NotNil(t, testSumoLogger.sendLogs(testLogs), "should be an error probing the primary")
+    assert.Equal(t, 2 + testThreshold, testClient.requestCounts["primary.example.org"], "should have probed the primary")
+    assert.Equal(t, 1, testSumoLogger.failover.activeEndpoint().index, "should still use the secondary")
+    assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should be no errors sending logs")
+    assert.Equal(t, 2, testClient.requestCounts["secondary.example.org"], "should have sent to the secondary")
+  })
+
+  t.Run("primary recovered", func(t *testing.T) {
+    testClient.setStatusCode("primary.example.org", http.StatusOK)
+    time.Sleep(100 * time.Millisecond)
+    assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should be no errors sending logs")
+    assert.Equal(t, 0, testSumoLogger.failover.activeEndpoint().index, "should have failed back to the primary")
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricFailbacks).String(), "should have counted the failback")
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricActiveEndpoint).String(), "should expose the active endpoint")
+  })
+}
+
+func TestFailoverPermanentError(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  testPrimaryUrl, _ := url.Parse(testPrimaryHttpSourceUrl)
+  testSecondaryUrl, _ := url.Parse(testSecondaryHttpSourceUrl)
+  testLogs := []*sumoLog{{source: testSource, line: testLine}}
+  testThreshold := 2
+  testPinError := &permanentError{err: fmt.Errorf("no certificate of the server matches %s", logOptTlsPinSha256)}
+
+  testClient := NewMockEndpointsHttpClient()
+  testClient.setError("primary.example.org", testPinError)
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: testPrimaryHttpSourceUrl,
+    httpClient: testClient,
+    failover: newSumoFailover([]*url.URL{testPrimaryUrl, testSecondaryUrl}, testThreshold, time.Hour),
+  }
+
+  for i := 0; i < testThreshold; i++ {
+    err := testSumoLogger.sendLogs(testLogs)
+    assert.NotNil(t, err, "should be an error sending logs")
+    assert.False(t, isPermanentError(err), "should retry while another endpoint may accept the batch")
+  }
+  assert.Equal(t, 1, testSumoLogger.failover.activeEndpoint().index, "should have failed over as for any other error")
+  assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should send to the secondary")
+
+  testClient.setError("secondary.example.org", testPinError)
+  err := testSumoLogger.sendLogs(testLogs)
+  assert.True(t, isPermanentError(err), "should drop the batch once every endpoint failed for good")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sync"
+
+  "github.com/pkg/errors"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  fileSinkScheme = "file"
+  fileSinkMode = 0600
+)
+
+/* fileSink is an HttpClient that writes request bodies to size-rotated local files
+  instead of sending them, so the files contain exactly what would have been sent to Sumo. */
+type fileSink struct {
+  path string
+  maxSize int
+  maxFiles int
+
+  file *os.File
+  size int
+  mu sync.Mutex
+}
+
+/* newFileSink returns a sink writing to the path, which is only created by create or by the first write. */
+func newFileSink(path string, maxSize int, maxFiles int) *fileSink {
+  return &fileSink{
+    path: path,
+    maxSize: maxSize,
+    maxFiles: maxFiles,
+  }
+}
+
+/* createFileSinks creates the files of the file:// destinations, so that a bad path fails the start
+  of the container rather than its first batch. */
+func createFileSinks(destinations []*sumoLogger) error {
+  for _, destination := range destinations {
+    if fileSink, isFileSink := destination.httpClient.(*fileSink); isFileSink {
+      fileSink.mu.Lock()
+      err := fileSink.create()
+      fileSink.mu.Unlock()
+      if err != nil {
+        return errors.Wrapf(err, "error opening output file: %q", fileSink.path)
+      }
+    }
+  }
+  return nil
+}
+
+/* create creates the directory of the file and opens it, unless it's open already. */
+func (fileSink *fileSink) create() error {
+  if fileSink.file != nil {
+    return nil
+  }
+  if err := os.MkdirAll(filepath.Dir(fileSink.path), fileMode); err != nil {
+    return err
+  }
+  return fileSink.open()
+}
+
+func (fileSink *fileSink) Do(req *http.Request) (*http.Response, error) {
+  var body []byte
+  if req.Body != nil {
+    var err error
+    body, err = ioutil.ReadAll(req.Body)
+    req.Body.Close()
+    if err != nil {
+      return nil, err
+    }
+  }
+  if err := fileSink.write(body); err != nil {
+    return nil, err
+  }
+  return &http.Response{
+    Status: "200 OK",
+    StatusCode: http.StatusOK,
+    Body: ioutil.NopCloser(bytes.NewReader(nil)),
+    Request: req,
+  }, nil
+}
+
+func (fileSink *fileSink) write(body []byte) error {
+  fileSink.mu.Lock()
+  defer fileSink.mu.Unlock()
+  if err := fileSink.create(); err != nil {
+    return err
+  }
+  if fileSink.size > 0 && fileSink.size + len(body) > fileSink.maxSize {
+    if err := fileSink.rotate(); err != nil {
+      return err
+    }
+  }
+  n, err := fileSink.file.Write(body)
+  fileSink.size += n
+  return err
+}
+
+func (fileSink *fileSink) open() error {
+  file, err := os.OpenFile(fileSink.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, fileSinkMode)
+  if err != nil {
+    return err
+  }
+  info, err := file.Stat()
+  if err != nil {
+    file.Close()
+    return err
+  }
+  fileSink.file = file
+  fileSink.size = int(info.Size())
+  return nil
+}
+
+/* rotate shifts path.1 ... path.(maxFiles-1) up by one, moves the current file to path.1
+  and starts a new one, dropping the oldest file. If it fails, the next write opens the file again. */
+func (fileSink *fileSink) rotate() error {
+  err := fileSink.file.Close()
+  fileSink.file = nil
+  if err != nil {
+    return err
+  }
+  /* older files missing is expected, other errors only leave an older file in place */
+  if err := os.Remove(rotatedFileName(fileSink.path, fileSink.maxFiles)); err != nil && !os.IsNotExist(err) {
+    logrus.Error(fmt.Errorf("%s: Failed to remove rotated file. %v", pluginName, err))
+  }
+  for i := fileSink.maxFiles - 1; i > 0; i-- {
+    err := os.Rename(rotatedFileName(fileSink.path, i), rotatedFileName(fileSink.path, i + 1))
+    if err != nil && !os.IsNotExist(err) {
+      logrus.Error(fmt.Errorf("%s: Failed to shift rotated file. %v", pluginName, err))
+    }
+  }
+  if err := os.Rename(fileSink.path, rotatedFileName(fileSink.path, 1)); err != nil {
+    return err
+  }
+  return fileSink.open()
+}
+
+func (fileSink *fileSink) Close() error {
+  fileSink.mu.Lock()
+  defer fileSink.mu.Unlock()
+  if fileSink.file == nil {
+    return nil
+  }
+  err := fileSink.file.Close()
+  fileSink.file = nil
+  return err
+}
+
+func rotatedFileName(path string, index int) string {
+  return fmt.Sprintf("%s.%d", path, index)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+  "bytes"
+  "compress/gzip"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+const (
+  testFileSinkDir = "/tmp/sumo-file-sink"
+  testFileSinkPath = testFileSinkDir + "/logs.out"
+)
+
+func TestFileSink(t *testing.T) {
+  t.Run("write and rotate", func(t *testing.T) {
+    defer os.RemoveAll(testFileSinkDir)
+    testBody := []byte("0123456789")
+    testFileSink := newFileSink(testFileSinkPath, 25, 2)
+    defer testFileSink.Close()
+
+    for i := 0; i < 2; i++ {
+      request, _ := http.NewRequest("POST", "file://" + testFileSinkPath, bytes.NewBuffer(testBody))
+      response, err := testFileSink.Do(request)
+      assert.Nil(t, err, "should be no error writing to the file")
+      assert.Equal(t, http.StatusOK, response.StatusCode, "should respond with OK")
+    }
+    content, _ := ioutil.ReadFile(testFileSinkPath)
+    assert.Equal(t, append(testBody, testBody...), content, "should append request bodies to the file")
+
+    for i := 0; i < 5; i++ {
+      request, _ := http.NewRequest("POST", "file://" + testFileSinkPath, bytes.NewBuffer(testBody))
+      _, err := testFileSink.Do(request)
+      assert.Nil(t, err, "should be no error writing to the file")
+    }
+    content, _ = ioutil.ReadFile(testFileSinkPath)
+    assert.Equal(t, testBody, content, "should have rotated the file when it reached max size")
+    _, err := os.Stat(rotatedFileName(testFileSinkPath, 1))
+    assert.Nil(t, err, "should have kept the rotated file")
+    _, err = os.Stat(rotatedFileName(testFileSinkPath, 2))
+    assert.Nil(t, err, "should have kept the rotated file")
+    _, err = os.Stat(rotatedFileName(testFileSinkPath, 3))
+    assert.True(t, os.IsNotExist(err), "should have dropped files beyond max files")
+  })
+
+  t.Run("recovers from a failed rotation", func(t *testing.T) {
+    defer os.RemoveAll(testFileSinkDir)
+    logrus.SetOutput(ioutil.Discard)
+    testBody := []byte("0123456789")
+    testFileSink := newFileSink(testFileSinkPath, 10, 1)
+    defer testFileSink.Close()
+
+    assert.Nil(t, testFileSink.write(testBody))
+    /* a non-empty directory in the way of the rotated file */
+    assert.Nil(t, os.MkdirAll(rotatedFileName(testFileSinkPath, 1) + "/blocked", fileMode))
+    assert.NotNil(t, testFileSink.write(testBody), "should fail to rotate")
+    assert.NotNil(t, testFileSink.write(testBody), "should try to rotate again")
+
+    os.RemoveAll(rotatedFileName(testFileSinkPath, 1))
+    assert.Nil(t, testFileSink.write([]byte("abc")), "should open the file again once it can rotate")
+    content, _ := ioutil.ReadFile(testFileSinkPath)
+    assert.Equal(t, "abc", string(content))
+    content, _ = ioutil.ReadFile(rotatedFileName(testFileSinkPath, 1))
+    assert.Equal(t, testBody, content, "should have rotated the file")
+
+    assert.Nil(t, testFileSink.Close())
+    assert.Nil(t, testFileSink.write([]byte("def")), "should open the file again after close")
+    content, _ = ioutil.ReadFile(testFileSinkPath)
+    assert.Equal(t, "abcdef", string(content))
+  })
+
+  t.Run("sendLogs with gzip compression", func(t *testing.T) {
+    defer os.RemoveAll(testFileSinkDir)
+    testFileSink := newFileSink(testFileSinkPath, defaultFileMaxSizeBytes, defaultFileMaxFiles)
+    defer testFileSink.Close()
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: "file://" + testFileSinkPath,
+      httpClient: testFileSink,
+      gzipCompression: true,
+      gzipCompressionLevel: defaultGzipCompressionLevel,
+    }
+    testLogs := []*sumoLog{{source: testSource, line: testLine}}
+
+    assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should be no errors sending logs")
+    assert.Nil(t, testSumoLogger.sendLogs(testLogs), "should be no errors sending logs")
+
+    testFile, _ := os.Open(testFileSinkPath)
+    defer testFile.Close()
+    verifyGzipReader, err := gzip.NewReader(testFile)
+    assert.Nil(t, err, "file should be in the gzip wire format")
+    content, _ := ioutil.ReadAll(verifyGzipReader)
+    expected := append(append(testLine, '\n'), append(testLine, '\n')...)
+    assert.Equal(t, expected, content, "file should contain all logs sent")
+  })
+
+  t.Run("small and large batches with compression", func(t *testing.T) {
+    defer os.RemoveAll(testFileSinkDir)
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrl: "file://" + testFileSinkPath,
+        logOptGzipCompression: "true",
+        logOptCompressMinSize: "1KB",
+      },
+      ContainerName: testContainerName,
+    }
+    testSumoLogger, err := newSumoDestination(info, nil, "", nil)
+    assert.Nil(t, err)
+    defer testSumoLogger.closeHttpClient()
+    assert.Equal(t, 0, testSumoLogger.compressMinSize, "file url, should compress every batch")
+
+    smallLogs := []*sumoLog{{source: testSource, line: []byte("small")}}
+    largeLine := bytes.Repeat([]byte("large "), 1000)
+    largeLogs := []*sumoLog{{source: testSource, line: largeLine}}
+    assert.Nil(t, testSumoLogger.sendLogs(smallLogs))
+    assert.Nil(t, testSumoLogger.sendLogs(largeLogs))
+
+    testFile, _ := os.Open(testFileSinkPath)
+    defer testFile.Close()
+    verifyGzipReader, err := gzip.NewReader(testFile)
+    assert.Nil(t, err, "file should be in the gzip wire format")
+    content, err := ioutil.ReadAll(verifyGzipReader)
+    assert.Nil(t, err, "file should decompress as a whole")
+    assert.Equal(t, "small\n" + string(largeLine) + "\n", string(content), "file should contain both batches")
+  })
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+)
+
+/* sumoFlushTrigger sends the batch of an urgent line right away, e.g. an error, instead of waiting for
+  the batch to fill up or the sending interval. To keep a flood of urgent lines from turning into one
+  request per line, batches are sent for urgent lines at most once per minimum interval. */
+type sumoFlushTrigger struct {
+  match *regexp.Regexp
+  stream string
+  minInterval time.Duration
+  /* only used by the batching goroutine */
+  lastFlush time.Time
+}
+
+/* matches returns whether the log is urgent, matching either the pattern or the stream. */
+func (flushTrigger *sumoFlushTrigger) matches(log *sumoLog) bool {
+  if flushTrigger == nil {
+    return false
+  }
+  return (flushTrigger.stream != "" && flushTrigger.stream == log.source) ||
+    (flushTrigger.match != nil && flushTrigger.match.Match(log.line))
+}
+
+/* flushAt returns when the batch of an urgent line is sent: now, or the end of the minimum interval
+  since the last batch sent for an urgent line. */
+func (flushTrigger *sumoFlushTrigger) flushAt(now time.Time) time.Time {
+  if next := flushTrigger.lastFlush.Add(flushTrigger.minInterval); next.After(now) {
+    return next
+  }
+  return now
+}
+
+/* parseLogOptFlushTrigger returns the flush trigger of sumo-flush-match and sumo-flush-stream, or nil if neither is set. */
+func parseLogOptFlushTrigger(info logger.Info) (*sumoFlushTrigger, error) {
+  matchInput, matchExists := info.Config[logOptFlushMatch]
+  stream, streamExists := info.Config[logOptFlushStream]
+  if !matchExists && !streamExists {
+    return nil, nil
+  }
+  flushTrigger := &sumoFlushTrigger{
+    minInterval: parseLogOptDuration(info, logOptFlushMinInterval, defaultFlushMinInterval),
+  }
+  if matchExists {
+    match, err := parseFlushMatch(logOptFlushMatch, matchInput)
+    if err != nil {
+      return nil, errors.Wrapf(err, "%s", pluginName)
+    }
+    flushTrigger.match = match
+  }
+  if streamExists {
+    if err := validateStream(logOptFlushStream, stream); err != nil {
+      return nil, errors.Wrapf(err, "%s", pluginName)
+    }
+    flushTrigger.stream = stream
+  }
+  return flushTrigger, nil
+}
+
+func parseFlushMatch(logOptKey string, input string) (*regexp.Regexp, error) {
+  match, err := regexp.Compile(input)
+  if err != nil {
+    return nil, fmt.Errorf("%s is not a valid regular expression. %v", logOptKey, err)
+  }
+  return match, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestParseLogOptFlushTrigger(t *testing.T) {
+  t.Run("not set", func(t *testing.T) {
+    flushTrigger, err := parseLogOptFlushTrigger(logger.Info{Config: map[string]string{}})
+    assert.Nil(t, err)
+    assert.Nil(t, flushTrigger, "no urgent lines specified, should be disabled")
+  })
+
+  t.Run("match and stream", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptFlushMatch: "ERROR|FATAL",
+        logOptFlushStream: "stderr",
+        logOptFlushMinInterval: "500ms",
+      },
+    }
+    flushTrigger, err := parseLogOptFlushTrigger(info)
+    assert.Nil(t, err)
+    assert.Equal(t, 500 * time.Millisecond, flushTrigger.minInterval, "min interval specified, should be specified value")
+    assert.True(t, flushTrigger.matches(&sumoLog{source: "stdout", line: []byte("an ERROR")}), "should match the pattern")
+    assert.True(t, flushTrigger.matches(&sumoLog{source: "stderr", line: []byte("a warning")}), "should match the stream")
+    assert.False(t, flushTrigger.matches(&sumoLog{source: "stdout", line: []byte("a warning")}))
+  })
+
+  t.Run("default min interval", func(t *testing.T) {
+    flushTrigger, err := parseLogOptFlushTrigger(logger.Info{Config: map[string]string{logOptFlushStream: "stderr"}})
+    assert.Nil(t, err)
+    assert.Equal(t, defaultFlushMinInterval, flushTrigger.minInterval)
+  })
+
+  t.Run("invalid", func(t *testing.T) {
+    _, err := parseLogOptFlushTrigger(logger.Info{Config: map[string]string{logOptFlushMatch: "ERROR("}})
+    assert.NotNil(t, err, "invalid pattern, should fail")
+    _, err = parseLogOptFlushTrigger(logger.Info{Config: map[string]string{logOptFlushStream: "stdin"}})
+    assert.NotNil(t, err, "invalid stream, should fail")
+  })
+}
+
+func TestBatchLogsFlushTrigger(t *testing.T) {
+  normalLog := &sumoLog{source: "stdout", line: []byte("normal")}
+  urgentLog := &sumoLog{source: "stderr", line: []byte("urgent")}
+  newTestSumoLogger := func(minInterval time.Duration) *sumoLogger {
+    return &sumoLogger{
+      httpSourceUrl: testHttpSourceUrl,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+      logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+      sendingInterval: time.Hour,
+      batchSize: defaultBatchSizeBytes,
+      flushTrigger: &sumoFlushTrigger{
+        stream: "stderr",
+        minInterval: minInterval,
+      },
+    }
+  }
+  receiveBatch := func(t *testing.T, logBatchQueue chan *sumoLogBatch, timeout time.Duration) *sumoLogBatch {
+    select {
+    case logBatch := <-logBatchQueue:
+      return logBatch
+    case <-time.After(timeout):
+      t.Fatal("should have sent a batch")
+      return nil
+    }
+  }
+
+  t.Run("urgent line sends the batch right away", func(t *testing.T) {
+    testSumoLogger := newTestSumoLogger(time.Second)
+    defer runBatchLogs(testSumoLogger)()
+
+    testSumoLogger.logQueue <- normalLog
+    time.Sleep(50 * time.Millisecond)
+    assert.Equal(t, 0, len(testSumoLogger.logBatchQueue), "should hold normal lines until the sending interval")
+    testSumoLogger.logQueue <- urgentLog
+    logBatch := receiveBatch(t, testSumoLogger.logBatchQueue, 100 * time.Millisecond)
+    assert.Equal(t, 2, len(logBatch.logs), "should send the urgent line with the lines before it")
+  })
+
+  t.Run("urgent lines are rate limited", func(t *testing.T) {
+    testSumoLogger := newTestSumoLogger(300 * time.Millisecond)
+    defer runBatchLogs(testSumoLogger)()
+
+    testSumoLogger.logQueue <- urgentLog
+    logBatch := receiveBatch(t, testSumoLogger.logBatchQueue, 100 * time.Millisecond)
+    assert.Equal(t, 1, len(logBatch.logs))
+    flushed := time.Now()
+    for i := 0; i < 10; i++ {
+      testSumoLogger.logQueue <- urgentLog
+    }
+    logBatch = receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+    assert.Equal(t, 10, len(logBatch.logs), "should send a flood of urgent lines in one batch")
+    assert.True(t, time.Since(flushed) >= 250 * time.Millisecond, "should wait for the min interval")
+    assert.Equal(t, 0, len(testSumoLogger.logBatchQueue))
+  })
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+  "encoding/binary"
+  "fmt"
+  "io"
+  "io/ioutil"
+
+  "github.com/docker/docker/api/types/plugins/logdriver"
+)
+
+const (
+  /* The size of a frame is a big endian uint32 before the LogEntry protobuf message. */
+  frameHeaderSize = 4
+  /* After this many bad frames in a row the fifo is taken as unreadable, and the logger stops reading it. */
+  maxConsecutiveBadFrames = 10
+  /* Frames up to this many times the max size, or 1MiB if larger, are skipped; larger sizes can't come from
+    Docker and mean the header itself is garbage, so the rest of the stream can't be framed. */
+  maxSkippedFrameFactor = 16
+  minSkippedFrameLimit = 1 << 20
+)
+
+/* badFrameError is returned for a frame that was skipped whole, the next frame being read from its start. */
+type badFrameError struct {
+  err error
+}
+
+func (badFrameError *badFrameError) Error() string {
+  return badFrameError.err.Error()
+}
+
+/* corruptFrameError is returned for a frame header whose size is far beyond any entry, after which
+  the position of the next frame is unknown. */
+type corruptFrameError struct {
+  size int64
+}
+
+func (corruptFrameError *corruptFrameError) Error() string {
+  return fmt.Sprintf("frame header of %d bytes is corrupt, the log stream can't be read further", corruptFrameError.size)
+}
+
+/* frameReader reads the log entries Docker writes to the fifo, as protoio's Uint32DelimitedReader does.
+  Unlike it, frames over the max size or failing to decode are skipped whole instead of leaving the reader
+  in the middle of a frame, where the rest of the stream would be misread. */
+type frameReader struct {
+  reader io.Reader
+  maxSize int
+  header [frameHeaderSize]byte
+  buffer []byte
+}
+
+func newFrameReader(reader io.Reader, maxSize int) *frameReader {
+  return &frameReader{
+    reader: reader,
+    maxSize: maxSize,
+  }
+}
+
+/* readFrame reads the next entry, returning a badFrameError if its frame was skipped,
+  or a corruptFrameError if the stream can't be read further. */
+func (frameReader *frameReader) readFrame(entry *logdriver.LogEntry) error {
+  entry.Reset()
+  if _, err := io.ReadFull(frameReader.reader, frameReader.header[:]); err != nil {
+    return err
+  }
+  size := int64(binary.BigEndian.Uint32(frameReader.header[:]))
+  if size > frameReader.skipLimit() {
+    return &corruptFrameError{size}
+  }
+  if size > int64(frameReader.maxSize) {
+    if _, err := io.CopyN(ioutil.Discard, frameReader.reader, size); err != nil {
+      return err
+    }
+    return &badFrameError{fmt.Errorf("frame of %d bytes is larger than %s (%d bytes)", size, logOptMaxFrameSize, frameReader.maxSize)}
+  }
+  if int64(cap(frameReader.buffer)) < size {
+    frameReader.buffer = make([]byte, size)
+  }
+  frameReader.buffer = frameReader.buffer[:size]
+  if _, err := io.ReadFull(frameReader.reader, frameReader.buffer); err != nil {
+    return err
+  }
+  /* the entry copies the line, so that the buffer can be reused for the next frame */
+  if err := entry.Unmarshal(frameReader.buffer); err != nil {
+    entry.Reset()
+    return &badFrameError{fmt.Errorf("failed to decode frame of %d bytes. %v", size, err)}
+  }
+  return nil
+}
+
+/* skipLimit returns the largest frame skipped whole, larger ones being taken as a corrupt header. */
+func (frameReader *frameReader) skipLimit() int64 {
+  limit := int64(frameReader.maxSize)
+  if limit < minSkippedFrameLimit {
+    limit = minSkippedFrameLimit
+  }
+  return limit * maxSkippedFrameFactor
+}
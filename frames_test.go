@@ -0,0 +1,147 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "io"
+  "io/ioutil"
+  "testing"
+
+  "github.com/docker/docker/api/types/plugins/logdriver"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+/* frameTestFile stands in for the fifo, reading frames written beforehand. */
+type frameTestFile struct {
+  *bytes.Buffer
+  closed bool
+}
+
+func (frameTestFile *frameTestFile) Close() error {
+  frameTestFile.closed = true
+  return nil
+}
+
+func writeTestFrame(buffer *bytes.Buffer, line string) {
+  logdriver.NewLogEntryEncoder(buffer).Encode(&logdriver.LogEntry{Source: testSource, Line: []byte(line)})
+}
+
+func writeRawTestFrame(buffer *bytes.Buffer, size uint32, body []byte) {
+  var header [frameHeaderSize]byte
+  binary.BigEndian.PutUint32(header[:], size)
+  buffer.Write(header[:])
+  buffer.Write(body)
+}
+
+func TestFrameReader(t *testing.T) {
+  var buffer bytes.Buffer
+  writeTestFrame(&buffer, "first")
+  writeRawTestFrame(&buffer, 100, bytes.Repeat([]byte("x"), 100))
+  /* wire type 7 doesn't exist */
+  writeRawTestFrame(&buffer, 1, []byte{0x0f})
+  writeTestFrame(&buffer, "second")
+  writeRawTestFrame(&buffer, 10, []byte("cut"))
+
+  frames := newFrameReader(&buffer, 50)
+  var entry logdriver.LogEntry
+  assert.Nil(t, frames.readFrame(&entry))
+  assert.Equal(t, "first", string(entry.Line))
+
+  err := frames.readFrame(&entry)
+  assert.IsType(t, &badFrameError{}, err, "frame over the max size, should be skipped")
+  assert.Contains(t, err.Error(), logOptMaxFrameSize)
+  assert.Empty(t, entry.Line, "should not keep the previous entry")
+
+  err = frames.readFrame(&entry)
+  assert.IsType(t, &badFrameError{}, err, "frame failing to decode, should be skipped")
+
+  assert.Nil(t, frames.readFrame(&entry), "should read the frame after the bad ones from its start")
+  assert.Equal(t, "second", string(entry.Line))
+
+  assert.Equal(t, io.ErrUnexpectedEOF, frames.readFrame(&entry), "truncated frame, should end the stream")
+
+  t.Run("garbage header", func(t *testing.T) {
+    var buffer bytes.Buffer
+    buffer.WriteString("garbage")
+    writeTestFrame(&buffer, "valid")
+    unread := buffer.Len() - frameHeaderSize
+    frames := newFrameReader(&buffer, 50)
+    err := frames.readFrame(&entry)
+    assert.IsType(t, &corruptFrameError{}, err, "size far beyond any frame, should not be skipped")
+    assert.Equal(t, unread, buffer.Len(), "should not discard the following frames")
+  })
+}
+
+func TestConsumeLogsFromFileBadFrames(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+
+  t.Run("bad frames are skipped", func(t *testing.T) {
+    inputFile := &frameTestFile{Buffer: new(bytes.Buffer)}
+    writeTestFrame(inputFile.Buffer, "first")
+    writeRawTestFrame(inputFile.Buffer, 1, []byte{0x0f})
+    writeRawTestFrame(inputFile.Buffer, fileReaderMaxSize + 1, bytes.Repeat([]byte("x"), fileReaderMaxSize + 1))
+    writeTestFrame(inputFile.Buffer, "second")
+    testSumoLogger := &sumoLogger{
+      inputFile: inputFile,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+      metrics: newSumoMetrics(t.Name()),
+    }
+    defer deleteSumoMetrics(t.Name())
+
+    testSumoLogger.consumeLogsFromFile()
+    var lines []string
+    for log := range testSumoLogger.logQueue {
+      lines = append(lines, string(log.line))
+    }
+    assert.Equal(t, []string{"first", "second"}, lines, "should only forward the good frames")
+    assert.Equal(t, "2", testSumoLogger.metrics.Get(metricBadFrames).String())
+    assert.True(t, inputFile.closed)
+  })
+
+  t.Run("gives up on a corrupt frame header", func(t *testing.T) {
+    inputFile := &frameTestFile{Buffer: new(bytes.Buffer)}
+    writeTestFrame(inputFile.Buffer, "first")
+    inputFile.Buffer.WriteString("garbage")
+    writeTestFrame(inputFile.Buffer, "unread")
+    testSumoLogger := &sumoLogger{
+      inputFile: inputFile,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+      metrics: newSumoMetrics(t.Name()),
+    }
+    defer deleteSumoMetrics(t.Name())
+
+    testSumoLogger.consumeLogsFromFile()
+    var lines []string
+    for log := range testSumoLogger.logQueue {
+      lines = append(lines, string(log.line))
+    }
+    assert.Equal(t, []string{"first"}, lines, "should stop reading, the next frames being misaligned")
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricBadFrames).String())
+    assert.True(t, inputFile.closed)
+  })
+
+  t.Run("gives up after repeated bad frames", func(t *testing.T) {
+    inputFile := &frameTestFile{Buffer: new(bytes.Buffer)}
+    for i := 0; i < maxConsecutiveBadFrames; i++ {
+      writeTestFrame(inputFile.Buffer, "good")
+      for j := 0; j <= i; j++ {
+        writeRawTestFrame(inputFile.Buffer, 1, []byte{0x0f})
+      }
+    }
+    writeTestFrame(inputFile.Buffer, "unread")
+    testSumoLogger := &sumoLogger{
+      inputFile: inputFile,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+    }
+
+    testSumoLogger.consumeLogsFromFile()
+    count := 0
+    for log := range testSumoLogger.logQueue {
+      assert.Equal(t, "good", string(log.line), "should stop reading after too many bad frames in a row")
+      count++
+    }
+    assert.Equal(t, maxConsecutiveBadFrames, count, "should count bad frames in a row only")
+    assert.True(t, inputFile.closed)
+  })
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "syscall"
+  "time"
+
+  "github.com/docker/docker/api/types/plugins/logdriver"
+  "github.com/docker/docker/daemon/logger"
+  "github.com/docker/go-plugins-helpers/sdk"
+  "github.com/sirupsen/logrus"
+  "github.com/tonistiigi/fifo"
+)
+
+const (
+  loadgenCommand = "loadgen"
+  /* Lines are written in bursts at this interval to reach the requested rate. */
+  loadgenTickInterval = 10 * time.Millisecond
+  loadgenTimestampField = "ts="
+)
+
+type loadgenConfig struct {
+  socket string
+  fifoDir string
+  containers int
+  rate int
+  lineSize int
+  duration time.Duration
+  drainTimeout time.Duration
+  logOpts logOptFlags
+}
+
+type loadgenReport struct {
+  containers int
+  duration time.Duration
+  writtenLines int64
+  writtenBytes int64
+  receivedLines int64
+  receivedBytes int64
+  latencies []time.Duration
+}
+
+/* loadgenReceiver stands in for the Sumo HTTP source, counting the lines it receives
+  and measuring their latency from the timestamp written in each line. */
+type loadgenReceiver struct {
+  mu sync.Mutex
+  lines int64
+  bytes int64
+  latencies []time.Duration
+}
+
+func (receiver *loadgenReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  body, err := decodeRequestBody(r.Header.Get("Content-Encoding"), r.Body)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  defer body.Close()
+  now := time.Now()
+  var lines, size int64
+  var latencies []time.Duration
+  scanner := bufio.NewScanner(body)
+  scanner.Buffer(make([]byte, 64 * 1024), fileReaderMaxSize)
+  for scanner.Scan() {
+    line := scanner.Text()
+    lines++
+    size += int64(len(line))
+    if sentAt, ok := parseLoadgenTimestamp(line); ok {
+      latencies = append(latencies, now.Sub(sentAt))
+    }
+  }
+  /* a body that can't be read whole, e.g. truncated or with a line over the max size, counts as not received */
+  if err := scanner.Err(); err != nil {
+    logrus.Error(fmt.Errorf("%s: Failed to read request body. %v", pluginName, err))
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  receiver.mu.Lock()
+  receiver.lines += lines
+  receiver.bytes += size
+  receiver.latencies = append(receiver.latencies, latencies...)
+  receiver.mu.Unlock()
+  w.WriteHeader(http.StatusOK)
+}
+
+func (receiver *loadgenReceiver) receivedLines() int64 {
+  receiver.mu.Lock()
+  defer receiver.mu.Unlock()
+  return receiver.lines
+}
+
+func loadgenLine(container int, seq int64, lineSize int) []byte {
+  line := []byte(fmt.Sprintf("loadgen container=%d seq=%d %s%d ", container, seq, loadgenTimestampField, time.Now().UnixNano()))
+  if len(line) < lineSize {
+    line = append(line, bytes.Repeat([]byte("x"), lineSize - len(line))...)
+  }
+  return line
+}
+
+func parseLoadgenTimestamp(line string) (time.Time, bool) {
+  i := strings.Index(line, loadgenTimestampField)
+  if i < 0 {
+    return time.Time{}, false
+  }
+  field := line[i + len(loadgenTimestampField):]
+  if j := strings.IndexByte(field, ' '); j >= 0 {
+    field = field[:j]
+  }
+  timestamp, err := strconv.ParseInt(field, stringToIntBase, 64)
+  if err != nil {
+    return time.Time{}, false
+  }
+  return time.Unix(0, timestamp), true
+}
+
+/* pluginClient calls the logging driver endpoints on the plugin socket, as dockerd does. */
+type pluginClient struct {
+  socket string
+  httpClient *http.Client
+}
+
+func newPluginClient(socket string) *pluginClient {
+  return &pluginClient{
+    socket: socket,
+    httpClient: &http.Client{
+      Transport: &http.Transport{
+        DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+          var dialer net.Dialer
+          return dialer.DialContext(ctx, "unix", socket)
+        },
+      },
+    },
+  }
+}
+
+func (pluginClient *pluginClient) call(path string, request interface{}) error {
+  body, err := json.Marshal(request)
+  if err != nil {
+    return err
+  }
+  response, err := pluginClient.httpClient.Post("http://plugin" + path, "application/json", bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  defer response.Body.Close()
+  var pluginResponse PluginResponse
+  if err := json.NewDecoder(response.Body).Decode(&pluginResponse); err != nil {
+    return fmt.Errorf("%s: invalid response from %s: %v", pluginName, path, err)
+  }
+  if pluginResponse.Err != "" {
+    return fmt.Errorf("%s", pluginResponse.Err)
+  }
+  return nil
+}
+
+/* servePlugin serves the logging driver in process on a socket of the given directory. */
+func servePlugin(dir string) (string, func(), error) {
+  socket := filepath.Join(dir, pluginName + ".sock")
+  listener, err := net.Listen("unix", socket)
+  if err != nil {
+    return "", nil, err
+  }
+  pluginHandler := sdk.NewHandler(`{"Implements": ["LoggingDriver"]}`)
+  initHandlers(&pluginHandler, newSumoDriver())
+  go pluginHandler.Serve(listener)
+  return socket, func() { listener.Close() }, nil
+}
+
+/* runLoadgen acts as dockerd for a number of containers: it creates their fifos, starts logging through
+  the plugin socket and writes log entries at the requested rate, sending them to a local receiver.
+  It then reports the throughput, the lines dropped and the latency. */
+func runLoadgen(config loadgenConfig) (*loadgenReport, error) {
+  receiver := &loadgenReceiver{}
+  receiverServer := &http.Server{Handler: receiver}
+  receiverListener, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    return nil, err
+  }
+  go receiverServer.Serve(receiverListener)
+  defer receiverServer.Close()
+
+  if err := os.MkdirAll(config.fifoDir, 0700); err != nil {
+    return nil, err
+  }
+  socket := config.socket
+  if socket == "" {
+    var stop func()
+    socket, stop, err = servePlugin(config.fifoDir)
+    if err != nil {
+      return nil, err
+    }
+    defer stop()
+    defer os.Remove(socket)
+  }
+  pluginClient := newPluginClient(socket)
+
+  logOpts := make(map[string]string)
+  for key, value := range config.logOpts {
+    logOpts[key] = value
+  }
+  logOpts[logOptUrl] = "http://" + receiverListener.Addr().String() + "/receiver/v1/http/loadgen"
+
+  var files []string
+  var writers []io.WriteCloser
+  defer func() {
+    for i, file := range files {
+      pluginClient.call(stopLoggingPath, StopLoggingRequest{File: file})
+      writers[i].Close()
+      os.Remove(file)
+    }
+  }()
+  for i := 0; i < config.containers; i++ {
+    file := filepath.Join(config.fifoDir, fmt.Sprintf("loadgen-%d-%d", os.Getpid(), i))
+    /* the same flags dockerd opens the fifo with */
+    writer, err := fifo.OpenFifo(context.Background(), file, syscall.O_WRONLY | syscall.O_CREAT | syscall.O_NONBLOCK, fileMode)
+    if err != nil {
+      return nil, err
+    }
+    files = append(files, file)
+    writers = append(writers, writer)
+    containerID := fmt.Sprintf("%012d%052d", i, os.Getpid())
+    err = pluginClient.call(startLoggingPath, StartLoggingRequest{
+      File: file,
+      Info: logger.Info{
+        Config: logOpts,
+        ContainerID: containerID,
+        ContainerName: fmt.Sprintf("/loadgen-%d", i),
+      },
+    })
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  report := &loadgenReport{
+    containers: config.containers,
+    duration: config.duration,
+  }
+  var wg sync.WaitGroup
+  deadline := time.Now().Add(config.duration)
+  for i, writer := range writers {
+    wg.Add(1)
+    go func(container int, writer io.Writer) {
+      defer wg.Done()
+      lines, size := writeLoadgenEntries(writer, container, config, deadline)
+      atomic.AddInt64(&report.writtenLines, lines)
+      atomic.AddInt64(&report.writtenBytes, size)
+    }(i, writer)
+  }
+  wg.Wait()
+
+  drainDeadline := time.Now().Add(config.drainTimeout)
+  for receiver.receivedLines() < report.writtenLines && time.Now().Before(drainDeadline) {
+    time.Sleep(loadgenTickInterval)
+  }
+  receiver.mu.Lock()
+  report.receivedLines = receiver.lines
+  report.receivedBytes = receiver.bytes
+  report.latencies = append([]time.Duration(nil), receiver.latencies...)
+  receiver.mu.Unlock()
+  return report, nil
+}
+
+/* writeLoadgenEntries writes log entries of one container at the configured rate until the deadline,
+  returning the number of lines and bytes written. */
+func writeLoadgenEntries(writer io.Writer, container int, config loadgenConfig, deadline time.Time) (int64, int64) {
+  encoder := logdriver.NewLogEntryEncoder(writer)
+  ticker := time.NewTicker(loadgenTickInterval)
+  defer ticker.Stop()
+  start := time.Now()
+  var lines, size int64
+  for now := range ticker.C {
+    if now.After(deadline) {
+      break
+    }
+    /* catch up with the rate since the start, so that slow writes don't lower it */
+    target := int64(now.Sub(start).Seconds() * float64(config.rate))
+    for ; lines < target; lines++ {
+      line := loadgenLine(container, lines, config.lineSize)
+      entry := &logdriver.LogEntry{
+        Source: "stdout",
+        TimeNano: time.Now().UnixNano(),
+        Line: line,
+      }
+      if err := encoder.Encode(entry); err != nil {
+        logrus.Error(fmt.Errorf("%s: loadgen container %d failed to write: %v", pluginName, container, err))
+        return lines, size
+      }
+      size += int64(len(line))
+    }
+  }
+  return lines, size
+}
+
+func latencyPercentile(sorted []time.Duration, percentile float64) time.Duration {
+  if len(sorted) == 0 {
+    return 0
+  }
+  return sorted[int(float64(len(sorted) - 1) * percentile)]
+}
+
+func (report *loadgenReport) print(output io.Writer) {
+  seconds := report.duration.Seconds()
+  fmt.Fprintf(output, "containers:  %d\n", report.containers)
+  fmt.Fprintf(output, "duration:    %s\n", report.duration)
+  fmt.Fprintf(output, "written:     %d lines, %d bytes (%.0f lines/s, %.2f MB/s)\n", report.writtenLines, report.writtenBytes,
+    float64(report.writtenLines) / seconds, float64(report.writtenBytes) / seconds / 1000000)
+  fmt.Fprintf(output, "received:    %d lines, %d bytes (%.0f lines/s, %.2f MB/s)\n", report.receivedLines, report.receivedBytes,
+    float64(report.receivedLines) / seconds, float64(report.receivedBytes) / seconds / 1000000)
+  dropped := report.writtenLines - report.receivedLines
+  droppedPercent := 0.0
+  if report.writtenLines > 0 {
+    droppedPercent = float64(dropped) * 100 / float64(report.writtenLines)
+  }
+  fmt.Fprintf(output, "dropped:     %d lines (%.2f%%)\n", dropped, droppedPercent)
+  latencies := append([]time.Duration(nil), report.latencies...)
+  sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+  max := time.Duration(0)
+  if len(latencies) > 0 {
+    max = latencies[len(latencies) - 1]
+  }
+  fmt.Fprintf(output, "latency:     p50 %s, p90 %s, p99 %s, max %s\n",
+    latencyPercentile(latencies, 0.5), latencyPercentile(latencies, 0.9), latencyPercentile(latencies, 0.99), max)
+}
+
+/* runLoadgenCommand parses the loadgen arguments and returns the exit code. */
+func runLoadgenCommand(args []string, output io.Writer) int {
+  flags := flag.NewFlagSet(loadgenCommand, flag.ContinueOnError)
+  flags.SetOutput(output)
+  config := loadgenConfig{logOpts: make(logOptFlags)}
+  flags.StringVar(&config.socket, "socket", "", "plugin socket to send StartLogging requests to; by default, the driver runs in process")
+  flags.StringVar(&config.fifoDir, "fifo-dir", filepath.Join(os.TempDir(), "sumo-loadgen"), "directory of the fifos, which must be reachable by the plugin")
+  flags.IntVar(&config.containers, "containers", 4, "number of containers")
+  flags.IntVar(&config.rate, "rate", 1000, "lines per second written by each container")
+  flags.IntVar(&config.lineSize, "line-size", 200, "size of each line in bytes")
+  flags.DurationVar(&config.duration, "duration", 10 * time.Second, "how long lines are written")
+  flags.DurationVar(&config.drainTimeout, "drain-timeout", 30 * time.Second, "how long to wait for the written lines to be received")
+  flags.Var(config.logOpts, "opt", "log option as key=value, e.g. --opt sumo-batch-size=2MB (repeatable)")
+  if err := flags.Parse(args); err != nil {
+    return 2
+  }
+  if config.containers <= 0 || config.rate <= 0 || config.lineSize <= 0 || config.duration <= 0 || flags.NArg() > 0 {
+    fmt.Fprintf(output, "Usage: docker-logging-driver %s [--containers N] [--rate N] [--line-size N] [--duration D] [--opt key=value ...]\n",
+      loadgenCommand)
+    flags.PrintDefaults()
+    return 2
+  }
+  logrus.SetOutput(ioutil.Discard)
+  report, err := runLoadgen(config)
+  if err != nil {
+    fmt.Fprintf(output, "error: %v\n", err)
+    return 1
+  }
+  report.print(output)
+  return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+  "bytes"
+  "compress/gzip"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestLoadgenLine(t *testing.T) {
+  line := loadgenLine(3, 42, 100)
+  assert.Equal(t, 100, len(line), "should pad the line to the line size")
+  assert.Contains(t, string(line), "loadgen container=3 seq=42 ts=")
+
+  sentAt, ok := parseLoadgenTimestamp(string(line))
+  assert.True(t, ok, "should parse the timestamp of the line")
+  assert.WithinDuration(t, time.Now(), sentAt, time.Second)
+
+  _, ok = parseLoadgenTimestamp("no timestamp here")
+  assert.False(t, ok, "should not parse a line without a timestamp")
+}
+
+func TestLoadgenReceiver(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  var compressed bytes.Buffer
+  gzipWriter := gzip.NewWriter(&compressed)
+  gzipWriter.Write(bytes.Repeat([]byte("line\n"), 1000))
+  gzipWriter.Close()
+
+  for _, test := range []struct {
+    name string
+    body []byte
+    contentEncoding string
+  }{
+    {"line over the max size", bytes.Repeat([]byte("x"), fileReaderMaxSize + 1), ""},
+    {"truncated body", compressed.Bytes()[:compressed.Len() / 2], compressCodecGzip},
+  } {
+    t.Run(test.name, func(t *testing.T) {
+      request := httptest.NewRequest("POST", "/", bytes.NewReader(test.body))
+      request.Header.Set("Content-Encoding", test.contentEncoding)
+      receiver := &loadgenReceiver{}
+      response := httptest.NewRecorder()
+      receiver.ServeHTTP(response, request)
+      assert.Equal(t, http.StatusBadRequest, response.Code, "should reject a body it can't read whole")
+      assert.Equal(t, int64(0), receiver.receivedLines(), "should not count the lines of the body")
+    })
+  }
+
+  receiver := &loadgenReceiver{}
+  response := httptest.NewRecorder()
+  receiver.ServeHTTP(response, httptest.NewRequest("POST", "/", bytes.NewReader([]byte("first\nsecond\n"))))
+  assert.Equal(t, http.StatusOK, response.Code)
+  assert.Equal(t, int64(2), receiver.receivedLines())
+}
+
+func TestRunLoadgen(t *testing.T) {
+  fifoDir, err := ioutil.TempDir("", "loadgen")
+  assert.Nil(t, err)
+
+  report, err := runLoadgen(loadgenConfig{
+    fifoDir: fifoDir,
+    containers: 2,
+    rate: 100,
+    lineSize: 64,
+    duration: time.Second,
+    drainTimeout: 5 * time.Second,
+    logOpts: logOptFlags{logOptSendingInterval: "100ms"},
+  })
+  assert.Nil(t, err)
+  assert.True(t, report.writtenLines > 0, "should write lines")
+  assert.Equal(t, report.writtenLines, report.receivedLines, "should receive all the lines written")
+  assert.Equal(t, report.writtenBytes, report.receivedBytes, "should receive all the bytes written")
+  assert.Equal(t, int(report.receivedLines), len(report.latencies), "should measure the latency of each line")
+
+  var output bytes.Buffer
+  report.print(&output)
+  assert.Contains(t, output.String(), "dropped:     0 lines (0.00%)")
+}
+
+func TestRunLoadgenCommandInvalidArguments(t *testing.T) {
+  var output bytes.Buffer
+  assert.Equal(t, 2, runLoadgenCommand([]string{"--containers", "0"}, &output), "invalid number of containers")
+  assert.Equal(t, 2, runLoadgenCommand([]string{"--opt", "novalue"}, &output), "invalid log option")
+}
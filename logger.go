@@ -1,9 +1,6 @@
 package main
 
 import (
-  "bytes"
-  "compress/gzip"
-  "encoding/binary"
   "fmt"
   "io"
   "io/ioutil"
@@ -14,7 +11,7 @@ import (
   "time"
 
   "github.com/docker/docker/api/types/plugins/logdriver"
-  protoio "github.com/gogo/protobuf/io"
+  "github.com/pkg/errors"
   "github.com/sirupsen/logrus"
 )
 
@@ -28,16 +25,46 @@ const (
   stringToIntBitSize = 32
 )
 
+var newline = []byte("\n")
+
+/* permanentError marks delivery errors that retrying cannot fix. */
+type permanentError struct {
+  err error
+}
+
+func (permanentError *permanentError) Error() string {
+  return permanentError.err.Error()
+}
+
+func (permanentError *permanentError) Unwrap() error {
+  return permanentError.err
+}
+
+func isPermanentError(err error) bool {
+  var permanent *permanentError
+  return errors.As(err, &permanent)
+}
+
 type sumoLog struct {
   line []byte
   source string
-  time string
+  /* when Docker read the line */
+  time time.Time
   isPartial bool
+  /* the line a dedup summary stands for, whose route the summary takes */
+  repeats *sumoLog
 }
 
 type sumoLogBatch struct {
   logs []*sumoLog
   sizeBytes int
+  route *sumoRoute
+  /* when the previous batch of the route was sent, from which the sending interval is counted */
+  created time.Time
+  /* when the first log was added, from which the age of the batch is counted */
+  firstLog time.Time
+  /* when the batch is sent for an urgent line, if it has any */
+  flushAt time.Time
 }
 
 func NewSumoLogBatch() *sumoLogBatch {
@@ -53,24 +80,41 @@ func (sumoLogBatch *sumoLogBatch) Reset() {
 }
 
 func (sumoLogger *sumoLogger) consumeLogsFromFile() {
-  /* https://github.com/gogo/protobuf/blob/master/io/uint32.go */
-  dec := protoio.NewUint32DelimitedReader(sumoLogger.inputFile, binary.BigEndian, fileReaderMaxSize)
-  defer dec.Close()
+  frames := newFrameReader(sumoLogger.inputFile, sumoLogger.frameSize())
   var log logdriver.LogEntry
+  badFrames := 0
   for {
-    if err := dec.ReadMsg(&log); err != nil {
-      if err == io.EOF || err == os.ErrClosed || strings.Contains(err.Error(), "file already closed") {
+    if err := frames.readFrame(&log); err != nil {
+      if err == io.EOF || err == io.ErrUnexpectedEOF || err == os.ErrClosed ||
+        strings.Contains(err.Error(), "file already closed") {
+        sumoLogger.inputFile.Close()
+        close(sumoLogger.logQueue)
+        return
+      }
+      /* the entry is never forwarded, a read error leaving it stale or partly decoded */
+      sumoLogger.addMetric(metricBadFrames, 1)
+      if _, corrupt := err.(*corruptFrameError); corrupt {
+        logrus.Error(fmt.Errorf("%s: Giving up reading logs of %s. %v", pluginName, sumoLogger.info.ContainerID, err))
         sumoLogger.inputFile.Close()
         close(sumoLogger.logQueue)
         return
       }
-      logrus.Error(err)
-      dec = protoio.NewUint32DelimitedReader(sumoLogger.inputFile, binary.BigEndian, fileReaderMaxSize)
+      badFrames++
+      if badFrames >= maxConsecutiveBadFrames {
+        logrus.Error(fmt.Errorf("%s: Giving up reading logs of %s after %d bad log entries in a row, the last one: %v",
+          pluginName, sumoLogger.info.ContainerID, badFrames, err))
+        sumoLogger.inputFile.Close()
+        close(sumoLogger.logQueue)
+        return
+      }
+      logrus.Error(fmt.Errorf("%s: Skipping log entry. %v", pluginName, err))
+      continue
     }
+    badFrames = 0
     sumoLog := &sumoLog{
       line: log.Line,
       source: log.Source,
-      time: time.Unix(0, log.TimeNano).String(),
+      time: time.Unix(0, log.TimeNano),
       isPartial: log.Partial,
     }
     sumoLogger.logQueue <- sumoLog
@@ -78,44 +122,192 @@ func (sumoLogger *sumoLogger) consumeLogsFromFile() {
   }
 }
 
+/* frameSize returns the maximum size of a log entry read from Docker. */
+func (sumoLogger *sumoLogger) frameSize() int {
+  if sumoLogger.maxFrameSize <= 0 {
+    return fileReaderMaxSize
+  }
+  return sumoLogger.maxFrameSize
+}
+
 func (sumoLogger *sumoLogger) batchLogs() {
-  ticker := time.NewTicker(sumoLogger.sendingInterval)
-  logBatch := NewSumoLogBatch()
+  now := time.Now()
+  /* one batch per route, the default route being nil */
+  logBatches := map[*sumoRoute]*sumoLogBatch{
+    nil: newRouteLogBatch(nil, now),
+  }
+  timer := time.NewTimer(sumoLogger.sendingInterval)
+  defer timer.Stop()
+  timerDeadline := now.Add(sumoLogger.sendingInterval)
   for {
     select {
     case log, open := <-sumoLogger.logQueue:
       if !open {
-        sumoLogger.logBatchQueue <- logBatch
-        close(sumoLogger.logBatchQueue)
+        if summary := sumoLogger.dedup.flush(); summary != nil {
+          sumoLogger.addLogToBatch(logBatches, summary, time.Now())
+        }
+        for route, logBatch := range logBatches {
+          if route == nil || len(logBatch.logs) > 0 {
+            sumoLogger.pushBatchToQueue(logBatch)
+          }
+        }
+        sumoLogger.closeBatchQueues()
         return
       }
-      if len(log.line) > sumoLogger.batchSize {
-        logrus.Warn(fmt.Sprintf("%s: Log is too large to batch, dropping log. log-size: %d bytes",
-          pluginName, len(log.line)))
-        continue
+      now = time.Now()
+      for _, log := range sumoLogger.dedup.filter(log, now) {
+        sumoLogger.addLogToBatch(logBatches, log, now)
+      }
+      /* the timer is only moved earlier here, a timer firing early just finds nothing to send yet */
+      if deadline := sumoLogger.nextFlush(logBatches, now); deadline.Before(timerDeadline) {
+        resetTimer(timer, deadline.Sub(now))
+        timerDeadline = deadline
+      }
+    case now = <-timer.C:
+      if summary := sumoLogger.dedup.expire(now); summary != nil {
+        sumoLogger.addLogToBatch(logBatches, summary, now)
+      }
+      sumoLogger.flushDueBatches(logBatches, now)
+      timerDeadline = sumoLogger.nextFlush(logBatches, now)
+      timer.Reset(timerDeadline.Sub(now))
+    }
+  }
+}
+
+func resetTimer(timer *time.Timer, duration time.Duration) {
+  if !timer.Stop() {
+    select {
+    case <-timer.C:
+    default:
+    }
+  }
+  timer.Reset(duration)
+}
+
+/* flushDueBatches sends the batches whose sending interval elapsed, unless they're under the minimum size,
+  and the batches reaching their maximum age. */
+func (sumoLogger *sumoLogger) flushDueBatches(logBatches map[*sumoRoute]*sumoLogBatch, now time.Time) {
+  for route, logBatch := range logBatches {
+    if len(logBatch.logs) == 0 {
+      /* nothing was sent, the interval starts again */
+      logBatch.created = now
+      continue
+    }
+    intervalElapsed := !now.Before(logBatch.created.Add(sumoLogger.sendingInterval))
+    tooOld := sumoLogger.batchMaxAge > 0 && !now.Before(logBatch.firstLog.Add(sumoLogger.batchMaxAge))
+    urgent := !logBatch.flushAt.IsZero() && !now.Before(logBatch.flushAt)
+    if (intervalElapsed && logBatch.sizeBytes >= sumoLogger.batchMinSize) || tooOld || urgent {
+      if urgent {
+        sumoLogger.flushTrigger.lastFlush = now
+        sumoLogger.addMetric(metricUrgentFlushes, 1)
       }
-      if logBatch.sizeBytes + len(log.line) > sumoLogger.batchSize {
-        sumoLogger.pushBatchToQueue(logBatch)
-        logBatch = NewSumoLogBatch()
+      sumoLogger.pushBatchToQueue(logBatch)
+      logBatches[route] = newRouteLogBatch(route, now)
+    }
+  }
+}
+
+/* nextFlush returns when the next batch is due, or the next sending interval if none is. */
+func (sumoLogger *sumoLogger) nextFlush(logBatches map[*sumoRoute]*sumoLogBatch, now time.Time) time.Time {
+  deadline := now.Add(sumoLogger.sendingInterval)
+  for _, logBatch := range logBatches {
+    if len(logBatch.logs) == 0 {
+      continue
+    }
+    if logBatch.sizeBytes >= sumoLogger.batchMinSize {
+      if intervalDeadline := logBatch.created.Add(sumoLogger.sendingInterval); intervalDeadline.Before(deadline) {
+        deadline = intervalDeadline
       }
-      logBatch.logs = append(logBatch.logs, log)
-      logBatch.sizeBytes += len(log.line)
-    case <-ticker.C:
-      if len(logBatch.logs) > 0 {
-        sumoLogger.pushBatchToQueue(logBatch)
-        logBatch = NewSumoLogBatch()
+    }
+    if sumoLogger.batchMaxAge > 0 {
+      if ageDeadline := logBatch.firstLog.Add(sumoLogger.batchMaxAge); ageDeadline.Before(deadline) {
+        deadline = ageDeadline
       }
     }
+    if !logBatch.flushAt.IsZero() && logBatch.flushAt.Before(deadline) {
+      deadline = logBatch.flushAt
+    }
+  }
+  return deadline
+}
+
+func newRouteLogBatch(route *sumoRoute, now time.Time) *sumoLogBatch {
+  logBatch := NewSumoLogBatch()
+  logBatch.route = route
+  logBatch.created = now
+  return logBatch
+}
+
+/* addLogToBatch batches the log, which is only read: it may be shared with the reader of the queue. */
+func (sumoLogger *sumoLogger) addLogToBatch(logBatches map[*sumoRoute]*sumoLogBatch, log *sumoLog, now time.Time) {
+  route := sumoLogger.routeFor(log)
+  /* urgent lines are matched before the timestamp is added, for patterns anchored at the start */
+  urgent := sumoLogger.flushTrigger.matches(log)
+  for _, stampedLog := range sumoLogger.fitLog(log) {
+    sumoLogger.batchLog(logBatches, route, stampedLog, urgent, now)
+  }
+}
+
+/* batchLog adds a stamped log to the batch of its route, sending the batch first if the log doesn't fit in it. */
+func (sumoLogger *sumoLogger) batchLog(logBatches map[*sumoRoute]*sumoLogBatch, route *sumoRoute, log *sumoLog, urgent bool, now time.Time) {
+  logBatch, exists := logBatches[route]
+  if !exists || logBatch.sizeBytes + len(log.line) > sumoLogger.batchSize {
+    if exists {
+      sumoLogger.pushBatchToQueue(logBatch)
+    }
+    logBatch = newRouteLogBatch(route, now)
+    logBatches[route] = logBatch
+  }
+  if len(logBatch.logs) == 0 {
+    logBatch.firstLog = now
+  }
+  logBatch.logs = append(logBatch.logs, log)
+  logBatch.sizeBytes += len(log.line)
+  if urgent {
+    if flushAt := sumoLogger.flushTrigger.flushAt(now); logBatch.flushAt.IsZero() || flushAt.Before(logBatch.flushAt) {
+      logBatch.flushAt = flushAt
+    }
+  }
+  flushNow := !logBatch.flushAt.IsZero() && !now.Before(logBatch.flushAt)
+  if flushNow || (sumoLogger.batchMaxLines > 0 && len(logBatch.logs) >= sumoLogger.batchMaxLines) {
+    if flushNow {
+      sumoLogger.flushTrigger.lastFlush = now
+      sumoLogger.addMetric(metricUrgentFlushes, 1)
+    }
+    sumoLogger.pushBatchToQueue(logBatch)
+    logBatches[route] = newRouteLogBatch(route, now)
   }
 }
 
 func (sumoLogger *sumoLogger) pushBatchToQueue(logBatch *sumoLogBatch) {
+  enqueueBatch(sumoLogger.logBatchQueue, logBatch)
+  /* batches routed to their own HTTP source are not copied to the additional destinations */
+  if logBatch.route != nil && logBatch.route.httpSourceUrl != "" {
+    return
+  }
+  for _, destination := range sumoLogger.destinations {
+    enqueueBatch(destination.logBatchQueue, &sumoLogBatch{
+      logs: logBatch.logs,
+      sizeBytes: logBatch.sizeBytes,
+      route: logBatch.route,
+    })
+  }
+}
+
+func (sumoLogger *sumoLogger) closeBatchQueues() {
+  close(sumoLogger.logBatchQueue)
+  for _, destination := range sumoLogger.destinations {
+    close(destination.logBatchQueue)
+  }
+}
+
+func enqueueBatch(logBatchQueue chan *sumoLogBatch, logBatch *sumoLogBatch) {
   select {
-  case sumoLogger.logBatchQueue <- logBatch:
+  case logBatchQueue <- logBatch:
   default:
-    <-sumoLogger.logBatchQueue
+    <-logBatchQueue
     logrus.Error(fmt.Errorf("%s: Log batch queue full, dropping oldest batch", pluginName))
-    sumoLogger.logBatchQueue <- logBatch
+    logBatchQueue <- logBatch
   }
 }
 
@@ -124,16 +316,29 @@ func (sumoLogger *sumoLogger) handleBatchedLogs() {
   for {
     logBatch, open := <-sumoLogger.logBatchQueue
     if !open {
+      sumoLogger.closeHttpClient()
       return
     }
+    /* the batch is encoded on the first attempt only, each destination having its own payload */
+    var payload *sumoPayload
     for {
       logrus.Debug(fmt.Sprintf("%s: Sending logs batch. batch-size: %d bytes",
         pluginName, logBatch.sizeBytes))
-      err := sumoLogger.sendLogs(logBatch.logs)
+      var err error
+      if payload == nil {
+        payload, err = sumoLogger.encodeLogBatch(logBatch)
+      }
+      if err == nil {
+        err = sumoLogger.sendPayload(logBatch, payload)
+      }
       if err == nil {
         retryInterval = initialRetryInterval
         break
       }
+      if isPermanentError(err) {
+        logrus.Error(fmt.Errorf("%s: Dropping logs batch, retrying cannot succeed. %v", pluginName, err))
+        break
+      }
       logrus.Debug(fmt.Sprintf("%s: Sleeping for %s before retry...",
         pluginName, retryInterval.String()))
       time.Sleep(retryInterval)
@@ -142,30 +347,82 @@ func (sumoLogger *sumoLogger) handleBatchedLogs() {
           math.Min(retryInterval.Seconds() * retryMultiplier, maxRetryInterval.Seconds())) * time.Second
       }
     }
+    if payload != nil {
+      payload.release()
+    }
   }
 }
 
 func (sumoLogger *sumoLogger) sendLogs(logs []*sumoLog) error {
-  var logsBatch bytes.Buffer
-  if sumoLogger.gzipCompression {
-    if err := sumoLogger.writeMessageGzipCompression(&logsBatch, logs); err != nil {
-      return err
-    }
+  return sumoLogger.sendLogBatch(&sumoLogBatch{logs: logs})
+}
+
+/* encodeLogBatch returns a new payload of the batch, which the caller releases once it's sent or dropped. */
+func (sumoLogger *sumoLogger) encodeLogBatch(logBatch *sumoLogBatch) (*sumoPayload, error) {
+  payload := newSumoPayload()
+  var err error
+  if sumoLogger.gzipCompression && logsSize(logBatch.logs) >= sumoLogger.compressMinSize {
+    err = sumoLogger.writeMessageAdaptive(payload.buffer, logBatch.logs)
+    payload.contentEncoding = sumoLogger.contentEncoding()
   } else {
-    if err := sumoLogger.writeMessage(&logsBatch, logs); err != nil{
-      return err
+    if sumoLogger.gzipCompression {
+      sumoLogger.addMetric(metricUncompressedBatches, 1)
     }
+    err = sumoLogger.writeMessage(payload.buffer, logBatch.logs)
   }
+  if err != nil {
+    payload.release()
+    return nil, err
+  }
+  return payload, nil
+}
 
-  request, err := http.NewRequest("POST", sumoLogger.httpSourceUrl, bytes.NewBuffer(logsBatch.Bytes()))
+/* sendLogBatch encodes and sends the batch once. */
+func (sumoLogger *sumoLogger) sendLogBatch(logBatch *sumoLogBatch) error {
+  payload, err := sumoLogger.encodeLogBatch(logBatch)
   if err != nil {
     return err
   }
-  if sumoLogger.gzipCompression {
-    request.Header.Add("Content-Encoding", "gzip")
+  defer payload.release()
+  return sumoLogger.sendPayload(logBatch, payload)
+}
+
+/* sendPayload sends the encoded batch to the destination of its route. */
+func (sumoLogger *sumoLogger) sendPayload(logBatch *sumoLogBatch, logsBatch *sumoPayload) error {
+  sourceCategory := sumoLogger.sourceCategory
+  if route := logBatch.route; route != nil {
+    if route.sourceCategory != "" {
+      sourceCategory = route.sourceCategory
+    }
+    if route.httpSourceUrl != "" {
+      return sumoLogger.postLogs(route.httpSourceUrl, sourceCategory, logsBatch)
+    }
+  }
+  httpSourceUrl, failover := sumoLogger.endpoint()
+  if failover != nil {
+    return sumoLogger.sendToEndpoint(failover, func(httpSourceUrl string) error {
+      return sumoLogger.postLogs(httpSourceUrl, sourceCategory, logsBatch)
+    })
+  }
+  return sumoLogger.postLogs(httpSourceUrl, sourceCategory, logsBatch)
+}
+
+func (sumoLogger *sumoLogger) postLogs(httpSourceUrl string, sourceCategory string, logsBatch *sumoPayload) error {
+  request, err := http.NewRequest("POST", httpSourceUrl, nil)
+  if err != nil {
+    return redactUrlError(err)
+  }
+  /* the body reads the cached payload without copying it */
+  request.Body = logsBatch.body()
+  request.ContentLength = int64(logsBatch.Len())
+  request.GetBody = func() (io.ReadCloser, error) {
+    return logsBatch.body(), nil
   }
-  if sumoLogger.sourceCategory != "" {
-    request.Header.Add("X-Sumo-Category", sumoLogger.sourceCategory)
+  if logsBatch.contentEncoding != "" {
+    request.Header.Add("Content-Encoding", logsBatch.contentEncoding)
+  }
+  if sourceCategory != "" {
+    request.Header.Add("X-Sumo-Category", sourceCategory)
   }
   if sumoLogger.sourceName != "" {
     request.Header.Add("X-Sumo-Name", sumoLogger.sourceName)
@@ -177,7 +434,7 @@ func (sumoLogger *sumoLogger) sendLogs(logs []*sumoLog) error {
 
   response, err := sumoLogger.httpClient.Do(request)
   if err != nil {
-    return err
+    return redactUrlError(err)
   }
 
   defer response.Body.Close()
@@ -192,8 +449,12 @@ func (sumoLogger *sumoLogger) sendLogs(logs []*sumoLog) error {
 }
 
 func (sumoLogger *sumoLogger) writeMessage(writer io.Writer, logs []*sumoLog) error {
+  /* appending the newline could modify a line shared with other destinations */
   for _, log := range logs {
-    if _, err := writer.Write(append(log.line, []byte("\n")...)); err != nil {
+    if _, err := writer.Write(log.line); err != nil {
+      return err
+    }
+    if _, err := writer.Write(newline); err != nil {
       return err
     }
   }
@@ -201,15 +462,5 @@ func (sumoLogger *sumoLogger) writeMessage(writer io.Writer, logs []*sumoLog) er
 }
 
 func (sumoLogger *sumoLogger) writeMessageGzipCompression(writer io.Writer, logs []*sumoLog) error {
-  gzipWriter, err := gzip.NewWriterLevel(writer, sumoLogger.gzipCompressionLevel)
-  if err != nil {
-    return err
-  }
-  if err := sumoLogger.writeMessage(gzipWriter, logs); err != nil {
-    return err
-  }
-  if err := gzipWriter.Close(); err != nil {
-    return err
-  }
-  return nil
+  return sumoLogger.writeMessageCodec(writer, logs, compressCodecGzip, sumoLogger.gzipCompressionLevel)
 }
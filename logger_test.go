@@ -4,8 +4,8 @@ import (
   "bytes"
   "compress/gzip"
   "context"
+  "io"
   "io/ioutil"
-  "math"
   "net/http"
   "os"
   "testing"
@@ -21,15 +21,21 @@ import (
 type mockHttpClient struct {
   requestCount int
   statusCode int
+  /* if set, requests after this many get StatusOK */
+  failures int
   requestReceivedSignal chan bool
 }
 
 func (m *mockHttpClient) Do(req *http.Request) (*http.Response, error) {
   m.requestCount += 1
+  statusCode := m.statusCode
+  if m.failures > 0 && m.requestCount > m.failures {
+    statusCode = http.StatusOK
+  }
   m.requestReceivedSignal <- true
   return &http.Response{
       Body: ioutil.NopCloser(bytes.NewBuffer([]byte("ERROR EXPECTED, mock response for testing"))),
-      StatusCode: m.statusCode,
+      StatusCode: statusCode,
     }, nil
 }
 
@@ -73,6 +79,7 @@ func TestConsumeLogsFromFile(t *testing.T) {
     enc.Encode(testLogMessage)
     consumedLog := <-testSumoLogger.logQueue
     assert.Equal(t, testSource, consumedLog.source, "should read the correct log source")
+    assert.True(t, time.Unix(0, testTime).Equal(consumedLog.time), "should read the correct log time")
     assert.Equal(t, testLine, consumedLog.line, "should read the correct log line")
     assert.Equal(t, testIsPartial, consumedLog.isPartial, "should read the correct log partial")
   })
@@ -93,6 +100,20 @@ func TestConsumeLogsFromFile(t *testing.T) {
   })
 }
 
+/* runBatchLogs runs batchLogs until the returned function closes the log queue, then waits for it to return,
+  so that it doesn't outlive the test. */
+func runBatchLogs(testSumoLogger *sumoLogger) func() {
+  done := make(chan struct{})
+  go func() {
+    defer close(done)
+    testSumoLogger.batchLogs()
+  }()
+  return func() {
+    close(testSumoLogger.logQueue)
+    <-done
+  }
+}
+
 func TestBatchLogs(t *testing.T) {
   logrus.SetOutput(ioutil.Discard)
   testSumoLog := &sumoLog{
@@ -111,7 +132,7 @@ func TestBatchLogs(t *testing.T) {
       sendingInterval: 400 * time.Millisecond,
       batchSize: 1,
     }
-    go testSumoLogger.batchLogs()
+    defer runBatchLogs(testSumoLogger)()
 
     testLogQueue <- testSumoLog
     time.Sleep(500 * time.Millisecond)
@@ -129,7 +150,7 @@ func TestBatchLogs(t *testing.T) {
       sendingInterval: time.Second,
       batchSize: testBatchSize,
     }
-    go testSumoLogger.batchLogs()
+    defer runBatchLogs(testSumoLogger)()
 
     testLogQueue <- testSumoLog
     testLogBatch := <-testLogBatchQueue
@@ -149,10 +170,12 @@ func TestBatchLogs(t *testing.T) {
       sendingInterval: time.Hour,
       batchSize: testBatchSize,
     }
-    go testSumoLogger.batchLogs()
+    defer runBatchLogs(testSumoLogger)()
 
     testLogCount := 100000
+    sent := make(chan struct{})
     go func() {
+      defer close(sent)
       for i := 0; i < testLogCount; i++ {
         testLogQueue <- testSumoLog
       }
@@ -164,6 +187,7 @@ func TestBatchLogs(t *testing.T) {
       assert.Equal(t, testLine, testLogBatch.logs[0].line, "should have received the correct log")
     }
     assert.Equal(t, 0, len(testLogBatchQueue), "should have emptied out the batch queue")
+    <-sent
   })
 
   t.Run("batchSize=2000000 bytes, testLogCount=1", func(t *testing.T) {
@@ -177,7 +201,7 @@ func TestBatchLogs(t *testing.T) {
       sendingInterval: time.Second,
       batchSize: testBatchSize,
     }
-    go testSumoLogger.batchLogs()
+    defer runBatchLogs(testSumoLogger)()
 
     testLogQueue <- testSumoLog
     testLogBatch := <-testLogBatchQueue
@@ -197,10 +221,12 @@ func TestBatchLogs(t *testing.T) {
       sendingInterval: time.Hour,
       batchSize: testBatchSize,
     }
-    go testSumoLogger.batchLogs()
+    defer runBatchLogs(testSumoLogger)()
 
     testLogCount := 1000000
+    sent := make(chan struct{})
     go func() {
+      defer close(sent)
       for i := 0; i < testLogCount; i++ {
         testLogQueue <- testSumoLog
       }
@@ -212,32 +238,71 @@ func TestBatchLogs(t *testing.T) {
       assert.Equal(t, testLine, testLogBatch.logs[0].line, "should have received the correct log")
     }
     assert.Equal(t, 0, len(testLogBatchQueue), "should have emptied out the batch queue")
+    <-sent
+  })
+
+  t.Run("dedup, testLogCount=1000", func(t *testing.T) {
+    testLogQueue := make(chan *sumoLog, 100 * defaultQueueSizeItems)
+    testLogBatchQueue := make(chan *sumoLogBatch, 10 * defaultQueueSizeItems)
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: testHttpSourceUrl,
+      logQueue: testLogQueue,
+      logBatchQueue: testLogBatchQueue,
+      sendingInterval: time.Hour,
+      batchSize: defaultBatchSizeBytes,
+      dedup: newSumoLogDedup(time.Hour, false),
+    }
+    go testSumoLogger.batchLogs()
+
+    testLogCount := 1000
+    for i := 0; i < testLogCount; i++ {
+      testLogQueue <- testSumoLog
+    }
+    close(testLogQueue)
+    testLogBatch := <-testLogBatchQueue
+    assert.Equal(t, 2, len(testLogBatch.logs), "should have received the first log and one summary")
+    assert.Equal(t, testLine, testLogBatch.logs[0].line, "should have received the correct log")
+    assert.Contains(t, string(testLogBatch.logs[1].line), "repeated 999 times",
+      "should have received the summary with the repeat count")
+    for range testLogBatchQueue {
+    }
   })
 }
 
+/* runHandleBatchedLogs runs handleBatchedLogs until the returned function closes the batch queue,
+  then waits for it to return, so that it doesn't outlive the test. */
+func runHandleBatchedLogs(testSumoLogger *sumoLogger) func() {
+  done := make(chan struct{})
+  go func() {
+    defer close(done)
+    testSumoLogger.handleBatchedLogs()
+  }()
+  return func() {
+    close(testSumoLogger.logBatchQueue)
+    <-done
+  }
+}
+
 func TestHandleBatchedLogs(t *testing.T) {
   logrus.SetOutput(ioutil.Discard)
-  testSumoLog := &sumoLog{
-    source: testSource,
-    line: testLine,
-    isPartial: testIsPartial,
-  }
-  testLogBatch := &sumoLogBatch{
-    logs: []*sumoLog{testSumoLog},
-    sizeBytes: len(testLine),
+  /* each batch is handed to a single handler, which owns it */
+  newTestLogBatch := func() *sumoLogBatch {
+    return &sumoLogBatch{
+      logs: []*sumoLog{{source: testSource, line: testLine, isPartial: testIsPartial}},
+      sizeBytes: len(testLine),
+    }
   }
 
   t.Run("status=OK, logBatchCount=1", func (t *testing.T) {
     testLogBatchQueue := make(chan *sumoLogBatch, defaultQueueSizeItems)
-    defer close(testLogBatchQueue)
     testClient := NewMockHttpClient(http.StatusOK)
     testSumoLogger := &sumoLogger{
       httpSourceUrl: testHttpSourceUrl,
       httpClient: testClient,
       logBatchQueue: testLogBatchQueue,
     }
-    go testSumoLogger.handleBatchedLogs()
-    testLogBatchQueue <- testLogBatch
+    defer runHandleBatchedLogs(testSumoLogger)()
+    testLogBatchQueue <- newTestLogBatch()
     <-testClient.requestReceivedSignal
     assert.Equal(t, 0, len(testLogBatchQueue),
       "should have emptied out the batch queue while handling")
@@ -247,19 +312,18 @@ func TestHandleBatchedLogs(t *testing.T) {
 
   t.Run("status=OK, logBatchCount=1000", func (t *testing.T) {
     testLogBatchQueue := make(chan *sumoLogBatch, defaultQueueSizeItems)
-    defer close(testLogBatchQueue)
     testClient := NewMockHttpClient(http.StatusOK)
     testSumoLogger := &sumoLogger{
       httpSourceUrl: testHttpSourceUrl,
       httpClient: testClient,
       logBatchQueue: testLogBatchQueue,
     }
-    go testSumoLogger.handleBatchedLogs()
+    defer runHandleBatchedLogs(testSumoLogger)()
 
     testLogBatchCount := 1000
     go func() {
       for i := 0; i < testLogBatchCount; i++ {
-        testLogBatchQueue <- testLogBatch
+        testLogBatchQueue <- newTestLogBatch()
       }
     }()
     for i := 0; i < testLogBatchCount; i++ {
@@ -273,18 +337,16 @@ func TestHandleBatchedLogs(t *testing.T) {
 
   t.Run("status=BadRequest", func (t *testing.T) {
     testLogBatchQueue := make(chan *sumoLogBatch, defaultQueueSizeItems)
-    defer close(testLogBatchQueue)
+    testRetryCount := 3
     testClient := NewMockHttpClient(http.StatusBadRequest)
+    testClient.failures = testRetryCount
     testSumoLogger := &sumoLogger{
      httpSourceUrl: testHttpSourceUrl,
      httpClient: testClient,
      logBatchQueue: testLogBatchQueue,
     }
-    go testSumoLogger.handleBatchedLogs()
-    testLogBatchQueue <- testLogBatch
-    testRetryCount := 3
-    testElapsedTime := initialRetryInterval * time.Duration(math.Pow(retryMultiplier, float64(testRetryCount)))
-    time.Sleep(testElapsedTime)
+    defer runHandleBatchedLogs(testSumoLogger)()
+    testLogBatchQueue <- newTestLogBatch()
     for i := 0; i < testRetryCount + 1; i++ {
      <-testClient.requestReceivedSignal
     }
@@ -463,3 +525,156 @@ func TestWriteMessageGzipCompression(t *testing.T) {
     "all logs should be written to the writer")
   verifyGzipReader.Close()
 }
+
+func TestBatchLogsThresholds(t *testing.T) {
+  testSumoLog := &sumoLog{
+    source: testSource,
+    line: testLine,
+  }
+  newTestSumoLogger := func() *sumoLogger {
+    return &sumoLogger{
+      httpSourceUrl: testHttpSourceUrl,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+      logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+      sendingInterval: time.Hour,
+      batchSize: defaultBatchSizeBytes,
+    }
+  }
+  receiveBatch := func(t *testing.T, logBatchQueue chan *sumoLogBatch, timeout time.Duration) *sumoLogBatch {
+    select {
+    case logBatch := <-logBatchQueue:
+      return logBatch
+    case <-time.After(timeout):
+      t.Fatal("should have sent a batch")
+      return nil
+    }
+  }
+
+  t.Run("max lines", func(t *testing.T) {
+    testSumoLogger := newTestSumoLogger()
+    testSumoLogger.batchMaxLines = 3
+    defer runBatchLogs(testSumoLogger)()
+
+    for i := 0; i < 7; i++ {
+      testSumoLogger.logQueue <- testSumoLog
+    }
+    for i := 0; i < 2; i++ {
+      logBatch := receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+      assert.Equal(t, 3, len(logBatch.logs), "should send a batch once it has max lines")
+    }
+    assert.Equal(t, 0, len(testSumoLogger.logBatchQueue), "should keep the remaining line")
+  })
+
+  t.Run("sending interval restarts after a size flush", func(t *testing.T) {
+    testSumoLogger := newTestSumoLogger()
+    testSumoLogger.sendingInterval = 400 * time.Millisecond
+    testSumoLogger.batchSize = 2 * len(testLine)
+    defer runBatchLogs(testSumoLogger)()
+
+    time.Sleep(250 * time.Millisecond)
+    for i := 0; i < 3; i++ {
+      testSumoLogger.logQueue <- testSumoLog
+    }
+    logBatch := receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+    assert.Equal(t, 2, len(logBatch.logs), "should send a full batch right away")
+    flushed := time.Now()
+    logBatch = receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+    assert.Equal(t, 1, len(logBatch.logs), "should send the remaining line at the sending interval")
+    assert.True(t, time.Since(flushed) >= 300 * time.Millisecond,
+      "should count the sending interval from the size flush, not from the previous tick")
+  })
+
+  t.Run("max age", func(t *testing.T) {
+    testSumoLogger := newTestSumoLogger()
+    testSumoLogger.batchMaxAge = 100 * time.Millisecond
+    defer runBatchLogs(testSumoLogger)()
+
+    time.Sleep(200 * time.Millisecond)
+    sent := time.Now()
+    testSumoLogger.logQueue <- testSumoLog
+    logBatch := receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+    assert.Equal(t, 1, len(logBatch.logs))
+    assert.True(t, time.Since(sent) >= 100 * time.Millisecond, "should count the age from the first line")
+  })
+
+  t.Run("min size", func(t *testing.T) {
+    testSumoLogger := newTestSumoLogger()
+    testSumoLogger.sendingInterval = 50 * time.Millisecond
+    testSumoLogger.batchMinSize = 3 * len(testLine)
+    testSumoLogger.batchMaxAge = 500 * time.Millisecond
+    defer runBatchLogs(testSumoLogger)()
+
+    sent := time.Now()
+    testSumoLogger.logQueue <- testSumoLog
+    time.Sleep(200 * time.Millisecond)
+    assert.Equal(t, 0, len(testSumoLogger.logBatchQueue), "should hold a batch under min size past the sending interval")
+    testSumoLogger.logQueue <- testSumoLog
+    testSumoLogger.logQueue <- testSumoLog
+    logBatch := receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+    assert.Equal(t, 3, len(logBatch.logs), "should send the batch once it reaches min size")
+    assert.True(t, time.Since(sent) < 500 * time.Millisecond, "should not wait for max age")
+
+    sent = time.Now()
+    testSumoLogger.logQueue <- testSumoLog
+    logBatch = receiveBatch(t, testSumoLogger.logBatchQueue, time.Second)
+    assert.Equal(t, 1, len(logBatch.logs), "should send a batch under min size at max age")
+    assert.True(t, time.Since(sent) >= 500 * time.Millisecond, "should hold the batch until max age")
+  })
+}
+
+/* benchmarkHttpClient reads each request body, as the transport does, failing the first attempts of each batch. */
+type benchmarkHttpClient struct {
+  failures int
+  attempts int
+}
+
+func (benchmarkHttpClient *benchmarkHttpClient) Do(req *http.Request) (*http.Response, error) {
+  io.Copy(ioutil.Discard, req.Body)
+  req.Body.Close()
+  statusCode := http.StatusOK
+  benchmarkHttpClient.attempts++
+  if benchmarkHttpClient.attempts <= benchmarkHttpClient.failures {
+    statusCode = http.StatusServiceUnavailable
+  } else {
+    benchmarkHttpClient.attempts = 0
+  }
+  return &http.Response{
+    Body: ioutil.NopCloser(bytes.NewReader(nil)),
+    StatusCode: statusCode,
+  }, nil
+}
+
+func benchmarkSendLogBatch(b *testing.B, gzipCompression bool, failures int) {
+  var testLogs []*sumoLog
+  for i := 0; i < 5000; i++ {
+    testLogs = append(testLogs, &sumoLog{source: testSource, line: bytes.Repeat([]byte("benchmark log line "), 10)})
+  }
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: testHttpSourceUrl,
+    httpClient: &benchmarkHttpClient{failures: failures},
+    gzipCompression: gzipCompression,
+    gzipCompressionLevel: defaultGzipCompressionLevel,
+  }
+  b.ReportAllocs()
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    logBatch := &sumoLogBatch{logs: testLogs}
+    payload, _ := testSumoLogger.encodeLogBatch(logBatch)
+    for attempt := 0; attempt <= failures; attempt++ {
+      testSumoLogger.sendPayload(logBatch, payload)
+    }
+    payload.release()
+  }
+}
+
+func BenchmarkSendLogBatch(b *testing.B) {
+  benchmarkSendLogBatch(b, false, 0)
+}
+
+func BenchmarkSendLogBatchGzip(b *testing.B) {
+  benchmarkSendLogBatch(b, true, 0)
+}
+
+func BenchmarkSendLogBatchGzipRetries(b *testing.B) {
+  benchmarkSendLogBatch(b, true, 2)
+}
@@ -3,7 +3,9 @@ package main
 import (
   "fmt"
   "encoding/json"
+  "expvar"
   "net/http"
+  "os"
 
   "github.com/docker/docker/daemon/logger"
   "github.com/docker/go-plugins-helpers/sdk"
@@ -17,6 +19,16 @@ const (
 )
 
 func main() {
+  if len(os.Args) > 1 && os.Args[1] == validateCommand {
+    os.Exit(runValidate(os.Args[2:], os.Stdout))
+  }
+  if len(os.Args) > 1 && os.Args[1] == loadgenCommand {
+    os.Exit(runLoadgenCommand(os.Args[2:], os.Stdout))
+  }
+  if len(os.Args) > 1 && os.Args[1] == receiverCommand {
+    os.Exit(runReceiver(os.Args[2:], os.Stdout))
+  }
+
   pluginHandler := sdk.NewHandler(`{"Implements": ["LoggingDriver"]}`)
 
   sumoDriver := newSumoDriver()
@@ -29,6 +41,7 @@ func main() {
 func initHandlers(pluginHandler *sdk.Handler, sumoDriver SumoDriver) {
   pluginHandler.HandleFunc(startLoggingPath, startLoggingHandler(sumoDriver))
   pluginHandler.HandleFunc(stopLoggingPath, stopLoggingHandler(sumoDriver))
+  pluginHandler.HandleFunc(metricsPath, expvar.Handler().ServeHTTP)
 }
 
 type StartLoggingRequest struct {
@@ -55,11 +68,16 @@ func startLoggingHandler(sumoDriver SumoDriver) func(w http.ResponseWriter, r *h
       respond(w, fmt.Errorf("must provide ContainerID in log context"))
       return
     }
-    if _, exists := req.Info.Config[logOptUrl]; !exists {
-      respond(w, fmt.Errorf("must provide log-opt: %s", logOptUrl))
+    info, err := resolveLogOpts(req.Info)
+    if err != nil {
+      respond(w, err)
+      return
+    }
+    if !hasLogOptUrl(info) {
+      respond(w, fmt.Errorf("must provide log-opt: %s, %s or %s", logOptUrl, logOptUrlFile, logOptUrlEnv))
       return
     }
-    err := sumoDriver.StartLogging(req.File, req.Info)
+    err = sumoDriver.StartLogging(req.File, info)
     respond(w, err)
   }
 }
@@ -7,6 +7,7 @@ import (
   "io/ioutil"
   "net/http"
   "net/http/httptest"
+  "os"
   "testing"
 
   "github.com/docker/docker/daemon/logger"
@@ -109,6 +110,48 @@ func TestHandlers(t *testing.T) {
     assert.Equal(t, "", respBody.Err, "error message should be empty")
   })
 
+  t.Run(fmt.Sprintf("make StartLogging request with log-opt: %s", logOptUrlFile), func(t *testing.T) {
+    defer resetCallsCount(mockSumoDriver)
+    req := StartLoggingRequest{
+      File: filePathRequestField,
+      Info: logger.Info{
+        Config: map[string]string{
+          logOptUrlFile: "/run/secrets/sumo-url",
+        },
+        ContainerID: "containeriid",
+      },
+    }
+    resp, respBody, err := makeRequest(startLoggingPath, req, mockServer)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    assert.Equal(t, http.StatusOK, resp.StatusCode, "should get a 200 response")
+    assert.Equal(t, 1, mockSumoDriver.StartLoggingCallsCount, "should have called StartLogging on the driver exactly once")
+    assert.Equal(t, "", respBody.Err, "error message should be empty")
+  })
+
+  t.Run("make StartLogging request with plugin default url", func(t *testing.T) {
+    defer resetCallsCount(mockSumoDriver)
+    os.Setenv("SUMO_URL", "https://example.org")
+    defer os.Unsetenv("SUMO_URL")
+    req := StartLoggingRequest{
+      File: filePathRequestField,
+      Info: logger.Info{
+        Config: map[string]string{},
+        ContainerID: "containeriid",
+      },
+    }
+    resp, respBody, err := makeRequest(startLoggingPath, req, mockServer)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    assert.Equal(t, http.StatusOK, resp.StatusCode, "should get a 200 response")
+    assert.Equal(t, 1, mockSumoDriver.StartLoggingCallsCount, "should have called StartLogging on the driver exactly once")
+    assert.Equal(t, "", respBody.Err, "error message should be empty")
+  })
+
   t.Run("make StopLogging request", func(t *testing.T) {
     defer resetCallsCount(mockSumoDriver)
     req := StopLoggingRequest{
@@ -0,0 +1,54 @@
+package main
+
+import (
+  "expvar"
+  "fmt"
+)
+
+const (
+  /* Metrics are served in the expvar JSON format on the plugin socket. */
+  metricsPath = "/debug/vars"
+
+  metricFailovers = "failovers"
+  metricFailbacks = "failbacks"
+  metricActiveEndpoint = "active_endpoint"
+  metricCompressLevel = "compress_level"
+  metricUncompressedBatches = "uncompressed_batches"
+  metricUrgentFlushes = "urgent_flushes"
+  metricOversizeDropped = "oversize_dropped"
+  metricOversizeTruncated = "oversize_truncated"
+  metricOversizeSplit = "oversize_split"
+  metricOversizeChunks = "oversize_chunks"
+  metricBadFrames = "bad_frames"
+)
+
+/* Metrics of all loggers, keyed by container ID. */
+var driverMetrics = expvar.NewMap(pluginName)
+
+func newSumoMetrics(name string) *expvar.Map {
+  metrics := new(expvar.Map).Init()
+  driverMetrics.Set(name, metrics)
+  return metrics
+}
+
+func destinationMetricsName(containerID string, index int) string {
+  return fmt.Sprintf("%s-%d", containerID, index)
+}
+
+func deleteSumoMetrics(name string) {
+  driverMetrics.Delete(name)
+}
+
+func (sumoLogger *sumoLogger) addMetric(key string, delta int64) {
+  if sumoLogger.metrics != nil {
+    sumoLogger.metrics.Add(key, delta)
+  }
+}
+
+func (sumoLogger *sumoLogger) setMetric(key string, value int64) {
+  if sumoLogger.metrics != nil {
+    gauge := new(expvar.Int)
+    gauge.Set(value)
+    sumoLogger.metrics.Set(key, gauge)
+  }
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+  "unicode/utf8"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  /* Lines larger than sumo-batch-size are dropped, as they can't be sent in a batch. */
+  oversizeModeDrop = "drop"
+  /* Lines larger than sumo-batch-size are cut to fit, ending with oversizeTruncatedMarker. */
+  oversizeModeTruncate = "truncate"
+  /* Lines larger than sumo-batch-size are sent in chunks, each starting with its index, e.g. [2/3]. */
+  oversizeModeSplit = "split"
+
+  oversizeTruncatedMarker = "...[truncated]"
+  oversizeSplitFormat = "[%d/%d] "
+)
+
+var oversizeModes = []string{oversizeModeDrop, oversizeModeTruncate, oversizeModeSplit}
+
+func parseLogOptOversizeMode(info logger.Info, logOptKey string, defaultValue string) string {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseOversizeMode(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %s", pluginName, err, defaultValue))
+      return defaultValue
+    }
+    return inputValue
+  }
+  return defaultValue
+}
+
+func parseOversizeMode(logOptKey string, input string) (string, error) {
+  mode := strings.ToLower(strings.TrimSpace(input))
+  for _, oversizeMode := range oversizeModes {
+    if mode == oversizeMode {
+      return mode, nil
+    }
+  }
+  return "", fmt.Errorf("Not supported mode '%s' for %s (supported values are %s)",
+    input, logOptKey, strings.Join(oversizeModes, ", "))
+}
+
+/* fitLog returns the log as stamped lines fitting in a batch, according to the oversize mode, or none if it's dropped.
+  The parts of a line are stamped each on its own, so that json lines stay whole. */
+func (sumoLogger *sumoLogger) fitLog(log *sumoLog) []*sumoLog {
+  stampedLog := sumoLogger.stampLog(log)
+  if len(stampedLog.line) <= sumoLogger.batchSize {
+    return []*sumoLog{stampedLog}
+  }
+  /* the room of a part is what its timestamp leaves, which in json also depends on the characters escaped
+    in the part, so the parts are cut again smaller until they all fit */
+  size := sumoLogger.batchSize - len(sumoLogger.stampLog(oversizeChunk(log, nil)).line)
+  for chunks := sumoLogger.cutLog(log, size); chunks != nil; chunks = sumoLogger.cutLog(log, size) {
+    excess := 0
+    for i, chunk := range chunks {
+      chunks[i] = sumoLogger.stampLog(chunk)
+      if len(chunks[i].line) - sumoLogger.batchSize > excess {
+        excess = len(chunks[i].line) - sumoLogger.batchSize
+      }
+    }
+    if excess == 0 {
+      if sumoLogger.oversizeMode == oversizeModeTruncate {
+        sumoLogger.addMetric(metricOversizeTruncated, 1)
+      } else {
+        sumoLogger.addMetric(metricOversizeSplit, 1)
+        sumoLogger.addMetric(metricOversizeChunks, int64(len(chunks)))
+      }
+      return chunks
+    }
+    size -= excess
+  }
+  logrus.Warn(fmt.Sprintf("%s: Log is too large to batch, dropping log. log-size: %d bytes",
+    pluginName, len(log.line)))
+  sumoLogger.addMetric(metricOversizeDropped, 1)
+  return nil
+}
+
+/* cutLog returns the log as lines of at most size bytes, according to the oversize mode, or nil if it can't. */
+func (sumoLogger *sumoLogger) cutLog(log *sumoLog, size int) []*sumoLog {
+  if len(log.line) <= size {
+    return []*sumoLog{log}
+  }
+  switch sumoLogger.oversizeMode {
+  case oversizeModeTruncate:
+    if room := size - len(oversizeTruncatedMarker); room > 0 {
+      line := make([]byte, 0, size)
+      line = append(line, log.line[:runeBoundary(log.line, room)]...)
+      line = append(line, oversizeTruncatedMarker...)
+      return []*sumoLog{oversizeChunk(log, line)}
+    }
+  case oversizeModeSplit:
+    if chunks := splitLine(log.line, size); chunks != nil {
+      logs := make([]*sumoLog, len(chunks))
+      for i, chunk := range chunks {
+        logs[i] = oversizeChunk(log, chunk)
+      }
+      return logs
+    }
+  }
+  return nil
+}
+
+func oversizeChunk(log *sumoLog, line []byte) *sumoLog {
+  chunk := *log
+  chunk.line = line
+  return &chunk
+}
+
+/* splitLine cuts the line in chunks of at most size bytes, each starting with its index among them,
+  or returns nil if the size leaves no room for the line after the index. */
+func splitLine(line []byte, size int) [][]byte {
+  var ends []int
+  for count := 1; len(ends) == 0 || len(ends) > count; {
+    if len(ends) > count {
+      count = len(ends)
+    }
+    /* the index of each chunk takes at most the room of the last one */
+    room := size - len(fmt.Sprintf(oversizeSplitFormat, count, count))
+    if room < utf8.UTFMax {
+      return nil
+    }
+    ends = ends[:0]
+    for start := 0; start < len(line); start = ends[len(ends) - 1] {
+      end := len(line)
+      if end - start > room {
+        end = start + runeBoundary(line[start:], room)
+      }
+      ends = append(ends, end)
+    }
+  }
+  chunks := make([][]byte, len(ends))
+  start := 0
+  for i, end := range ends {
+    prefix := fmt.Sprintf(oversizeSplitFormat, i + 1, len(ends))
+    chunk := make([]byte, 0, len(prefix) + end - start)
+    chunk = append(chunk, prefix...)
+    chunks[i] = append(chunk, line[start:end]...)
+    start = end
+  }
+  return chunks
+}
+
+/* runeBoundary returns the largest length up to size that doesn't cut a UTF-8 character of the line. */
+func runeBoundary(line []byte, size int) int {
+  for end := size; end > size - utf8.UTFMax && end > 0; end-- {
+    if utf8.RuneStart(line[end]) {
+      return end
+    }
+  }
+  return size
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/api/types/plugins/logdriver"
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+  "github.com/tonistiigi/fifo"
+  "golang.org/x/sys/unix"
+)
+
+func TestParseOversizeMode(t *testing.T) {
+  for _, mode := range oversizeModes {
+    parsed, err := parseOversizeMode(logOptOversizeMode, strings.ToUpper(mode))
+    assert.Nil(t, err)
+    assert.Equal(t, mode, parsed)
+  }
+  _, err := parseOversizeMode(logOptOversizeMode, "wrap")
+  assert.NotNil(t, err, "unknown mode, should fail")
+
+  info := logger.Info{Config: map[string]string{logOptOversizeMode: "wrap"}}
+  assert.Equal(t, defaultOversizeMode, parseLogOptOversizeMode(info, logOptOversizeMode, defaultOversizeMode),
+    "unknown mode, should be default")
+}
+
+func TestSplitLine(t *testing.T) {
+  t.Run("chunks fit and carry their index", func(t *testing.T) {
+    line := []byte(strings.Repeat("0123456789", 30))
+    chunks := splitLine(line, 50)
+    assert.Equal(t, 7, len(chunks))
+    var joined []byte
+    for i, chunk := range chunks {
+      assert.True(t, len(chunk) <= 50, "chunk should fit in the size")
+      prefix := fmt.Sprintf(oversizeSplitFormat, i + 1, len(chunks))
+      assert.True(t, bytes.HasPrefix(chunk, []byte(prefix)), "chunk should start with its index")
+      joined = append(joined, chunk[len(prefix):]...)
+    }
+    assert.Equal(t, line, joined, "chunks should hold the whole line")
+  })
+
+  t.Run("index growing by a digit", func(t *testing.T) {
+    line := []byte(strings.Repeat("x", 100))
+    chunks := splitLine(line, 16)
+    assert.Equal(t, 13, len(chunks))
+    for _, chunk := range chunks {
+      assert.True(t, len(chunk) <= 16, "chunk should fit in the size")
+    }
+    assert.Equal(t, "[13/13] xxxx", string(chunks[12]))
+  })
+
+  t.Run("multibyte characters are not cut", func(t *testing.T) {
+    chunks := splitLine([]byte(strings.Repeat("é", 20)), 12)
+    for _, chunk := range chunks {
+      assert.True(t, len(chunk) <= 12, "chunk should fit in the size")
+      assert.True(t, strings.HasSuffix(string(chunk), "é"), "chunk should end with a whole character")
+    }
+  })
+
+  t.Run("no room for the line", func(t *testing.T) {
+    assert.Nil(t, splitLine([]byte(strings.Repeat("x", 100)), 6))
+  })
+}
+
+func TestFitLog(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  testSumoLog := &sumoLog{
+    source: testSource,
+    line: []byte(strings.Repeat("x", 100)),
+    isPartial: testIsPartial,
+  }
+
+  t.Run("fits", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{batchSize: 100, oversizeMode: oversizeModeTruncate}
+    assert.Equal(t, []*sumoLog{testSumoLog}, testSumoLogger.fitLog(testSumoLog))
+  })
+
+  t.Run("drop", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{batchSize: 50, oversizeMode: oversizeModeDrop, metrics: newSumoMetrics(t.Name())}
+    defer deleteSumoMetrics(t.Name())
+    assert.Empty(t, testSumoLogger.fitLog(testSumoLog))
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricOversizeDropped).String())
+  })
+
+  t.Run("truncate", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{batchSize: 50, oversizeMode: oversizeModeTruncate, metrics: newSumoMetrics(t.Name())}
+    defer deleteSumoMetrics(t.Name())
+    logs := testSumoLogger.fitLog(testSumoLog)
+    assert.Equal(t, 1, len(logs))
+    assert.Equal(t, 50, len(logs[0].line), "should fill the batch size")
+    assert.True(t, strings.HasSuffix(string(logs[0].line), oversizeTruncatedMarker), "should end with the marker")
+    assert.Equal(t, testSource, logs[0].source, "should keep the source")
+    assert.Equal(t, 100, len(testSumoLog.line), "should not modify the original line")
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricOversizeTruncated).String())
+  })
+
+  t.Run("split", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{batchSize: 50, oversizeMode: oversizeModeSplit, metrics: newSumoMetrics(t.Name())}
+    defer deleteSumoMetrics(t.Name())
+    logs := testSumoLogger.fitLog(testSumoLog)
+    assert.Equal(t, 3, len(logs))
+    assert.Equal(t, "1", testSumoLogger.metrics.Get(metricOversizeSplit).String())
+    assert.Equal(t, "3", testSumoLogger.metrics.Get(metricOversizeChunks).String())
+  })
+
+  t.Run("split in a batch", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: testHttpSourceUrl,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+      logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+      sendingInterval: 100 * time.Millisecond,
+      batchSize: 50,
+      oversizeMode: oversizeModeSplit,
+    }
+    go testSumoLogger.batchLogs()
+    testSumoLogger.logQueue <- testSumoLog
+    close(testSumoLogger.logQueue)
+    count := 0
+    for logBatch := range testSumoLogger.logBatchQueue {
+      assert.True(t, logBatch.sizeBytes <= 50, "batch should fit in the batch size")
+      count += len(logBatch.logs)
+    }
+    assert.Equal(t, 3, count, "should send every chunk")
+  })
+}
+
+func TestConsumeLogsFromFileMaxFrameSize(t *testing.T) {
+  testFilePath := filePath + "-frame"
+  inputFile, err := fifo.OpenFifo(context.Background(), testFilePath, unix.O_RDWR|unix.O_CREAT|unix.O_NONBLOCK, fileMode)
+  defer os.Remove(testFilePath)
+  assert.Nil(t, err)
+
+  testSumoLogger := &sumoLogger{
+    inputFile: inputFile,
+    logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+    maxFrameSize: 2 * fileReaderMaxSize,
+  }
+  go testSumoLogger.consumeLogsFromFile()
+
+  testLine := bytes.Repeat([]byte("x"), 3 * fileReaderMaxSize / 2)
+  go logdriver.NewLogEntryEncoder(inputFile).Encode(&logdriver.LogEntry{Source: testSource, Line: testLine})
+  select {
+  case consumedLog := <-testSumoLogger.logQueue:
+    assert.Equal(t, len(testLine), len(consumedLog.line), "should read a frame over the default size")
+  case <-time.After(5 * time.Second):
+    t.Fatal("should have read the log")
+  }
+}
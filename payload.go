@@ -0,0 +1,69 @@
+package main
+
+import (
+  "bytes"
+  "io"
+  "sync"
+  "sync/atomic"
+)
+
+/* Buffers of encoded batches are reused, to avoid allocating a new payload of up to sumo-batch-size for each batch. */
+var payloadBufferPool = sync.Pool{
+  New: func() interface{} {
+    return new(bytes.Buffer)
+  },
+}
+
+/* sumoPayload is the encoded content of a batch, encoded once and sent as is by each attempt.
+  The transport may still read a request body after Do returns, so the buffer returns to the pool
+  only once the batch is done and the bodies of all its requests are closed. */
+type sumoPayload struct {
+  buffer *bytes.Buffer
+  refs int32
+  /* empty if the payload isn't compressed */
+  contentEncoding string
+}
+
+func newSumoPayload() *sumoPayload {
+  buffer := payloadBufferPool.Get().(*bytes.Buffer)
+  buffer.Reset()
+  return &sumoPayload{
+    buffer: buffer,
+    refs: 1,
+  }
+}
+
+func (sumoPayload *sumoPayload) Bytes() []byte {
+  return sumoPayload.buffer.Bytes()
+}
+
+func (sumoPayload *sumoPayload) Len() int {
+  return sumoPayload.buffer.Len()
+}
+
+/* body returns a request body reading the payload, which releases it when closed. */
+func (sumoPayload *sumoPayload) body() io.ReadCloser {
+  atomic.AddInt32(&sumoPayload.refs, 1)
+  return &payloadBody{
+    Reader: bytes.NewReader(sumoPayload.buffer.Bytes()),
+    payload: sumoPayload,
+  }
+}
+
+func (sumoPayload *sumoPayload) release() {
+  if atomic.AddInt32(&sumoPayload.refs, -1) == 0 {
+    payloadBufferPool.Put(sumoPayload.buffer)
+    sumoPayload.buffer = nil
+  }
+}
+
+type payloadBody struct {
+  *bytes.Reader
+  payload *sumoPayload
+  once sync.Once
+}
+
+func (payloadBody *payloadBody) Close() error {
+  payloadBody.once.Do(payloadBody.payload.release)
+  return nil
+}
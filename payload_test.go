@@ -0,0 +1,57 @@
+package main
+
+import (
+  "io/ioutil"
+  "net/http"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestSumoPayload(t *testing.T) {
+  payload := newSumoPayload()
+  payload.buffer.WriteString("payload")
+
+  firstBody := payload.body()
+  secondBody := payload.body()
+  content, _ := ioutil.ReadAll(firstBody)
+  assert.Equal(t, "payload", string(content), "should read the payload")
+  content, _ = ioutil.ReadAll(secondBody)
+  assert.Equal(t, "payload", string(content), "each body should read the whole payload")
+
+  payload.release()
+  firstBody.Close()
+  firstBody.Close()
+  assert.NotNil(t, payload.buffer, "should keep the buffer while a body is open")
+  secondBody.Close()
+  assert.Nil(t, payload.buffer, "should return the buffer once all bodies are closed")
+}
+
+func TestEncodeLogBatch(t *testing.T) {
+  testClient := NewMockHttpClient(http.StatusServiceUnavailable)
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: testHttpSourceUrl,
+    httpClient: testClient,
+    gzipCompression: true,
+    gzipCompressionLevel: defaultGzipCompressionLevel,
+  }
+  /* a line with spare capacity, as if it were shared with other destinations */
+  line := make([]byte, 0, 64)
+  line = append(line, testLine...)
+  logBatch := &sumoLogBatch{logs: []*sumoLog{{source: testSource, line: line}}}
+
+  payload, err := testSumoLogger.encodeLogBatch(logBatch)
+  assert.Nil(t, err)
+  assert.NotNil(t, testSumoLogger.sendPayload(logBatch, payload), "should fail to send")
+  assert.NotNil(t, testSumoLogger.sendPayload(logBatch, payload), "should fail to send")
+  assert.Equal(t, 2, testClient.requestCount, "should send each attempt")
+  assert.NotNil(t, payload.buffer, "should keep the payload across retries")
+  assert.Equal(t, testLine, line[:cap(line)][:len(testLine)], "should not modify the line")
+  assert.Equal(t, byte(0), line[:cap(line)][len(testLine)], "should not write the newline into the line")
+
+  otherPayload, err := testSumoLogger.encodeLogBatch(logBatch)
+  assert.Nil(t, err)
+  assert.True(t, payload != otherPayload, "should give each caller its own payload")
+  otherPayload.release()
+  payload.release()
+}
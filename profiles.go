@@ -0,0 +1,89 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "regexp"
+  "sort"
+  "strings"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+  "github.com/sirupsen/logrus"
+)
+
+/* Matches the URLs in log option values, so they can be redacted in debug output. */
+var logOptUrlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s",]+`)
+
+/* loadProfile returns the log options of the named profile of the profiles file,
+  a JSON object mapping profile names to objects of log options. */
+func loadProfile(profilesFile string, profile string) (map[string]string, error) {
+  content, err := ioutil.ReadFile(profilesFile)
+  if err != nil {
+    return nil, errors.Wrapf(err, "%s: failed to read %s", pluginName, logOptProfilesFile)
+  }
+  var profiles map[string]map[string]string
+  if err := json.Unmarshal(content, &profiles); err != nil {
+    return nil, errors.Wrapf(err, "%s: failed to parse profiles file %q", pluginName, profilesFile)
+  }
+  profileConfig, exists := profiles[profile]
+  if !exists {
+    var names []string
+    for name := range profiles {
+      names = append(names, name)
+    }
+    sort.Strings(names)
+    return nil, fmt.Errorf("%s: profile %q not found in %q (available profiles: %s)",
+      pluginName, profile, profilesFile, strings.Join(names, ", "))
+  }
+  for logOptKey := range profileConfig {
+    if logOptKey == logOptProfile || logOptKey == logOptProfilesFile {
+      return nil, fmt.Errorf("%s: profile %q can't set %s", pluginName, profile, logOptKey)
+    }
+  }
+  return profileConfig, nil
+}
+
+/* resolveLogOpts returns the log options of the container layered over those of its profile,
+  if any, layered over the plugin defaults. */
+func resolveLogOpts(info logger.Info) (logger.Info, error) {
+  defaults, err := loadPluginDefaults()
+  if err != nil {
+    return info, err
+  }
+  withDefaults := mergeLogOptDefaults(info, defaults)
+  profile, exists := withDefaults.Config[logOptProfile]
+  if !exists {
+    logResolvedLogOpts(withDefaults)
+    return withDefaults, nil
+  }
+  profilesFile, exists := withDefaults.Config[logOptProfilesFile]
+  if !exists {
+    return info, fmt.Errorf("%s: %s requires %s", pluginName, logOptProfile, logOptProfilesFile)
+  }
+  profileConfig, err := loadProfile(profilesFile, profile)
+  if err != nil {
+    return info, err
+  }
+  resolvedInfo := mergeLogOptDefaults(mergeLogOptDefaults(info, profileConfig), defaults)
+  logResolvedLogOpts(resolvedInfo)
+  return resolvedInfo, nil
+}
+
+func logResolvedLogOpts(info logger.Info) {
+  if !logrus.IsLevelEnabled(logrus.DebugLevel) {
+    return
+  }
+  var logOpts []string
+  for key, value := range info.Config {
+    logOpts = append(logOpts, key + "=" + redactLogOptValue(value))
+  }
+  sort.Strings(logOpts)
+  logrus.Debug(fmt.Sprintf("%s: Resolved log options for container %s: %s",
+    pluginName, info.ContainerID, strings.Join(logOpts, " ")))
+}
+
+func redactLogOptValue(value string) string {
+  return logOptUrlPattern.ReplaceAllStringFunc(value, redactUrl)
+}
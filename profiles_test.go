@@ -0,0 +1,70 @@
+package main
+
+import (
+  "bytes"
+  "io/ioutil"
+  "os"
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+const testProfilesFilePath = "/tmp/sumo-profiles.json"
+
+func TestResolveLogOptsProfile(t *testing.T) {
+  assert.Nil(t, ioutil.WriteFile(testProfilesFilePath, []byte(`{
+    "prod-eu": {"sumo-url": "` + testHttpSourceUrl + `/receiver/v1/http/profileToken0123456789", "sumo-source-category": "prod/eu", "sumo-batch-size": "2000000"},
+    "audit": {"sumo-source-category": "audit"}
+  }`), 0600))
+  defer os.Remove(testProfilesFilePath)
+  os.Setenv("SUMO_PROFILES_FILE", testProfilesFilePath)
+  defer os.Unsetenv("SUMO_PROFILES_FILE")
+  os.Setenv("SUMO_BATCH_SIZE", "1000")
+  defer os.Unsetenv("SUMO_BATCH_SIZE")
+  os.Setenv("SUMO_SENDING_INTERVAL", "5s")
+  defer os.Unsetenv("SUMO_SENDING_INTERVAL")
+
+  t.Run("profile between defaults and log options", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptProfile: "prod-eu",
+        logOptSourceCategory: "explicit",
+      },
+    }
+    resolvedInfo, err := resolveLogOpts(info)
+    assert.Nil(t, err)
+    assert.Equal(t, testHttpSourceUrl + "/receiver/v1/http/profileToken0123456789", resolvedInfo.Config[logOptUrl],
+      "url not specified, should be the profile value")
+    assert.Equal(t, "explicit", resolvedInfo.Config[logOptSourceCategory], "log options should override the profile")
+    assert.Equal(t, "2000000", resolvedInfo.Config[logOptBatchSize], "profile should override the defaults")
+    assert.Equal(t, "5s", resolvedInfo.Config[logOptSendingInterval], "not in the profile, should be the default")
+  })
+
+  t.Run("resolved log options in debug output", func(t *testing.T) {
+    var output bytes.Buffer
+    logrus.SetOutput(&output)
+    logrus.SetLevel(logrus.DebugLevel)
+    defer logrus.SetLevel(logrus.InfoLevel)
+    defer logrus.SetOutput(ioutil.Discard)
+
+    _, err := resolveLogOpts(logger.Info{Config: map[string]string{logOptProfile: "prod-eu"}, ContainerID: testContainerID})
+    assert.Nil(t, err)
+    assert.Contains(t, output.String(), "sumo-source-category=prod/eu", "should log the resolved log options")
+    assert.Contains(t, output.String(), "sumo-url=" + testHttpSourceUrl + "/receiver/v1/http/****6789", "should redact the url")
+    assert.NotContains(t, output.String(), "profileToken", "should not log the token")
+  })
+
+  t.Run("unknown profile", func(t *testing.T) {
+    _, err := resolveLogOpts(logger.Info{Config: map[string]string{logOptProfile: "prod-us"}})
+    assert.Error(t, err, "unknown profile should return an error")
+    assert.Contains(t, err.Error(), "audit, prod-eu", "error message should list the available profiles")
+  })
+
+  t.Run("profile without profiles file", func(t *testing.T) {
+    os.Unsetenv("SUMO_PROFILES_FILE")
+    _, err := resolveLogOpts(logger.Info{Config: map[string]string{logOptProfile: "audit"}})
+    assert.Error(t, err, "profiles file not specified, should return an error")
+  })
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/url"
+  "strings"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+)
+
+var proxySchemes = map[string]bool{
+  "http": true,
+  "https": true,
+  "socks5": true,
+  "socks5h": true,
+}
+
+var defaultPorts = map[string]string{
+  "http": "80",
+  "https": "443",
+}
+
+/* sumoProxy holds the proxy configuration of the http transport. */
+type sumoProxy struct {
+  url *url.URL
+  noProxy []string
+  connectHeader http.Header
+}
+
+func parseLogOptProxy(info logger.Info, proxyUrl *url.URL) (*sumoProxy, error) {
+  if proxyUrl == nil {
+    return &sumoProxy{}, nil
+  }
+  if !proxySchemes[proxyUrl.Scheme] {
+    return nil, fmt.Errorf("%s: Not supported proxy scheme '%s' for %s (supported schemes are http, https, socks5 and socks5h)",
+      pluginName, proxyUrl.Scheme, logOptProxyUrl)
+  }
+  /* the transport of Go 1.14 only dials socks5 proxies, which it already lets resolve host names, as socks5h means */
+  if proxyUrl.Scheme == "socks5h" {
+    socksProxyUrl := *proxyUrl
+    socksProxyUrl.Scheme = "socks5"
+    proxyUrl = &socksProxyUrl
+  }
+
+  if credentialsPath, exists := info.Config[logOptProxyCredentialsFile]; exists {
+    user, err := readProxyCredentials(credentialsPath)
+    if err != nil {
+      return nil, err
+    }
+    /* the url is shared with the caller, keep it without the credentials */
+    proxyUrlWithCredentials := *proxyUrl
+    proxyUrlWithCredentials.User = user
+    proxyUrl = &proxyUrlWithCredentials
+  }
+
+  sumoProxy := &sumoProxy{
+    url: proxyUrl,
+  }
+  if noProxy, exists := info.Config[logOptNoProxy]; exists {
+    for _, host := range strings.Split(noProxy, ",") {
+      if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+        sumoProxy.noProxy = append(sumoProxy.noProxy, host)
+      }
+    }
+  }
+  if connectHeaders, exists := info.Config[logOptProxyConnectHeaders]; exists {
+    var headers map[string]string
+    if err := json.Unmarshal([]byte(connectHeaders), &headers); err != nil {
+      return nil, errors.Wrapf(err, "%s: failed to parse %s as a JSON object", pluginName, logOptProxyConnectHeaders)
+    }
+    sumoProxy.connectHeader = make(http.Header)
+    for name, value := range headers {
+      sumoProxy.connectHeader.Set(name, value)
+    }
+  }
+  return sumoProxy, nil
+}
+
+/* readProxyCredentials reads the proxy user and password from a file containing user:password,
+  so they don't have to be part of the log options. */
+func readProxyCredentials(credentialsPath string) (*url.Userinfo, error) {
+  credentials, err := ioutil.ReadFile(credentialsPath)
+  if err != nil {
+    return nil, errors.Wrapf(err, "%s: failed to read proxy credentials", pluginName)
+  }
+  parts := strings.SplitN(strings.TrimSpace(string(credentials)), ":", 2)
+  if parts[0] == "" {
+    return nil, fmt.Errorf("%s: proxy credentials file %q must contain user:password", pluginName, credentialsPath)
+  }
+  if len(parts) == 1 {
+    return url.User(parts[0]), nil
+  }
+  return url.UserPassword(parts[0], parts[1]), nil
+}
+
+/* configure sets the proxy of the transport. */
+func (sumoProxy *sumoProxy) configure(transport *http.Transport) {
+  if sumoProxy.url == nil {
+    return
+  }
+  transport.Proxy = sumoProxy.proxyFor
+  transport.ProxyConnectHeader = sumoProxy.connectHeader
+}
+
+func (sumoProxy *sumoProxy) proxyFor(request *http.Request) (*url.URL, error) {
+  if sumoProxy.bypass(request.URL) {
+    return nil, nil
+  }
+  return sumoProxy.url, nil
+}
+
+/* bypass returns whether the url matches the no proxy list. Entries are either "*", an IP address,
+  a CIDR range, or a domain name which also matches its subdomains, each optionally with a port. */
+func (sumoProxy *sumoProxy) bypass(requestUrl *url.URL) bool {
+  host := strings.ToLower(requestUrl.Hostname())
+  port := requestUrl.Port()
+  if port == "" {
+    port = defaultPorts[requestUrl.Scheme]
+  }
+  ip := net.ParseIP(host)
+  for _, noProxy := range sumoProxy.noProxy {
+    if noProxy == "*" {
+      return true
+    }
+    if _, cidr, err := net.ParseCIDR(noProxy); err == nil {
+      if ip != nil && cidr.Contains(ip) {
+        return true
+      }
+      continue
+    }
+    noProxyHost, noProxyPort, err := net.SplitHostPort(noProxy)
+    if err != nil {
+      noProxyHost, noProxyPort = noProxy, ""
+    }
+    if noProxyPort != "" && noProxyPort != port {
+      continue
+    }
+    noProxyHost = strings.TrimPrefix(strings.Trim(noProxyHost, "[]"), "*")
+    if noProxyIp := net.ParseIP(noProxyHost); noProxyIp != nil {
+      if ip != nil && ip.Equal(noProxyIp) {
+        return true
+      }
+      continue
+    }
+    noProxyHost = strings.TrimPrefix(noProxyHost, ".")
+    if host == noProxyHost || strings.HasSuffix(host, "." + noProxyHost) {
+      return true
+    }
+  }
+  return false
+}
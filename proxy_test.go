@@ -0,0 +1,212 @@
+package main
+
+import (
+  "encoding/base64"
+  "encoding/binary"
+  "io"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "os"
+  "strconv"
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/stretchr/testify/assert"
+)
+
+const testProxyCredentialsPath = "/tmp/sumo-proxy-credentials"
+
+func TestParseLogOptProxy(t *testing.T) {
+  assert.Nil(t, ioutil.WriteFile(testProxyCredentialsPath, []byte("user:p@ss:word\n"), 0600))
+  defer os.Remove(testProxyCredentialsPath)
+
+  t.Run("credentials, no proxy and connect headers", func(t *testing.T) {
+    proxyUrl, _ := url.Parse("socks5://proxy.example.org:1080")
+    info := logger.Info{
+      Config: map[string]string{
+        logOptProxyCredentialsFile: testProxyCredentialsPath,
+        logOptNoProxy: "localhost, .internal.example.org,10.0.0.0/8,Example.com:8080",
+        logOptProxyConnectHeaders: `{"x-corp-token": "secret"}`,
+      },
+    }
+    sumoProxy, err := parseLogOptProxy(info, proxyUrl)
+    assert.Nil(t, err)
+    assert.Equal(t, "user", sumoProxy.url.User.Username(), "credentials file specified, should set the user")
+    password, _ := sumoProxy.url.User.Password()
+    assert.Equal(t, "p@ss:word", password, "credentials file specified, should set the password")
+    assert.Nil(t, proxyUrl.User, "should not modify the proxy url option")
+    assert.Equal(t, []string{"localhost", ".internal.example.org", "10.0.0.0/8", "example.com:8080"}, sumoProxy.noProxy)
+    assert.Equal(t, "secret", sumoProxy.connectHeader.Get("X-Corp-Token"), "connect headers specified, should be set")
+  })
+
+  t.Run("no proxy url", func(t *testing.T) {
+    sumoProxy, err := parseLogOptProxy(logger.Info{Config: map[string]string{logOptNoProxy: "*"}}, nil)
+    assert.Nil(t, err)
+    transport := &http.Transport{}
+    sumoProxy.configure(transport)
+    assert.Nil(t, transport.Proxy, "proxy url not specified, should not use a proxy")
+  })
+
+  for name, config := range map[string]map[string]string{
+    "missing credentials file": {logOptProxyCredentialsFile: "/tmp/sumo-missing-credentials"},
+    "bad connect headers": {logOptProxyConnectHeaders: `["x-corp-token"]`},
+  } {
+    t.Run(name, func(t *testing.T) {
+      proxyUrl, _ := url.Parse("http://proxy.example.org:3128")
+      _, err := parseLogOptProxy(logger.Info{Config: config}, proxyUrl)
+      assert.Error(t, err, "invalid proxy options should return an error")
+    })
+  }
+
+  t.Run("bad scheme", func(t *testing.T) {
+    proxyUrl, _ := url.Parse("ftp://proxy.example.org")
+    _, err := parseLogOptProxy(logger.Info{Config: map[string]string{}}, proxyUrl)
+    assert.Error(t, err, "not supported scheme should return an error")
+    assert.Contains(t, err.Error(), "socks5", "error message should list the supported schemes")
+  })
+}
+
+func TestProxyBypass(t *testing.T) {
+  testSumoProxy := &sumoProxy{
+    noProxy: []string{"localhost", ".internal.example.org", "10.0.0.0/8", "example.com:8080", "192.168.1.1", "[::1]"},
+  }
+  for rawUrl, expected := range map[string]bool{
+    "http://localhost/receiver": true,
+    "https://collector.internal.example.org": true,
+    "https://internal.example.org": true,
+    "https://notinternal.example.org": false,
+    "http://10.1.2.3:8080": true,
+    "http://11.1.2.3": false,
+    "http://example.com:8080": true,
+    "http://sub.example.com:8080": true,
+    "https://example.com": false,
+    "https://192.168.1.1": true,
+    "http://[::1]:8080": true,
+    "https://endpoint1.collection.sumologic.com": false,
+  } {
+    requestUrl, _ := url.Parse(rawUrl)
+    assert.Equal(t, expected, testSumoProxy.bypass(requestUrl), "bypass of %s", rawUrl)
+  }
+  everything := &sumoProxy{noProxy: []string{"*"}}
+  requestUrl, _ := url.Parse(testHttpSourceUrl)
+  assert.True(t, everything.bypass(requestUrl), "* should bypass the proxy for every host")
+}
+
+func TestProxyAuthentication(t *testing.T) {
+  assert.Nil(t, ioutil.WriteFile(testProxyCredentialsPath, []byte("user:password"), 0600))
+  defer os.Remove(testProxyCredentialsPath)
+
+  proxyAuthorizations := make(chan string, 1)
+  proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    proxyAuthorizations <- r.Header.Get("Proxy-Authorization")
+    w.WriteHeader(http.StatusOK)
+  }))
+  defer proxy.Close()
+
+  proxyUrl, _ := url.Parse(proxy.URL)
+  sumoProxy, err := parseLogOptProxy(logger.Info{Config: map[string]string{logOptProxyCredentialsFile: testProxyCredentialsPath}}, proxyUrl)
+  assert.Nil(t, err)
+  transport := &http.Transport{}
+  sumoProxy.configure(transport)
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: "http://collector.example.org/receiver",
+    httpClient: &http.Client{Transport: transport},
+  }
+  assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: testLine}}))
+  assert.Equal(t, "Basic " + base64.StdEncoding.EncodeToString([]byte("user:password")), <-proxyAuthorizations,
+    "should authenticate to the proxy with the credentials from the file")
+}
+
+/* serveTestSocks5 is a SOCKS5 proxy without authentication, which records the address of each connect request
+  and connects it to the target instead. */
+func serveTestSocks5(listener net.Listener, target string, requestedAddresses chan string) {
+  for {
+    conn, err := listener.Accept()
+    if err != nil {
+      return
+    }
+    go func() {
+      defer conn.Close()
+      greeting := make([]byte, 2)
+      if _, err := io.ReadFull(conn, greeting); err != nil {
+        return
+      }
+      if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+        return
+      }
+      conn.Write([]byte{5, 0})
+      request := make([]byte, 4)
+      if _, err := io.ReadFull(conn, request); err != nil {
+        return
+      }
+      var host string
+      switch request[3] {
+      case 1:
+        ip := make([]byte, net.IPv4len)
+        if _, err := io.ReadFull(conn, ip); err != nil {
+          return
+        }
+        host = net.IP(ip).String()
+      case 3:
+        length := make([]byte, 1)
+        if _, err := io.ReadFull(conn, length); err != nil {
+          return
+        }
+        name := make([]byte, length[0])
+        if _, err := io.ReadFull(conn, name); err != nil {
+          return
+        }
+        host = string(name)
+      default:
+        return
+      }
+      port := make([]byte, 2)
+      if _, err := io.ReadFull(conn, port); err != nil {
+        return
+      }
+      requestedAddresses <- net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+      targetConn, err := net.Dial("tcp", target)
+      if err != nil {
+        conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+        return
+      }
+      defer targetConn.Close()
+      conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+      go io.Copy(targetConn, conn)
+      io.Copy(conn, targetConn)
+    }()
+  }
+}
+
+func TestSocks5Proxy(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(http.StatusOK)
+  }))
+  defer server.Close()
+  listener, err := net.Listen("tcp", "127.0.0.1:0")
+  assert.Nil(t, err)
+  defer listener.Close()
+  requestedAddresses := make(chan string, 1)
+  go serveTestSocks5(listener, server.Listener.Addr().String(), requestedAddresses)
+
+  for _, scheme := range []string{"socks5", "socks5h"} {
+    t.Run(scheme, func(t *testing.T) {
+      proxyUrl, _ := url.Parse(scheme + "://" + listener.Addr().String())
+      sumoProxy, err := parseLogOptProxy(logger.Info{Config: map[string]string{}}, proxyUrl)
+      assert.Nil(t, err)
+      assert.Equal(t, "socks5", sumoProxy.url.Scheme, "should use the only socks scheme the transport of Go 1.14 dials")
+      transport := &http.Transport{}
+      defer transport.CloseIdleConnections()
+      sumoProxy.configure(transport)
+      testSumoLogger := &sumoLogger{
+        httpSourceUrl: "http://collector.example.org/receiver",
+        httpClient: &http.Client{Transport: transport},
+      }
+      assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: testLine}}), "should send the logs through the proxy")
+      assert.Equal(t, "collector.example.org:80", <-requestedAddresses, "should let the proxy resolve the host name")
+    })
+  }
+}
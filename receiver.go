@@ -0,0 +1,330 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "compress/gzip"
+  "compress/zlib"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/klauspost/compress/zstd"
+)
+
+const (
+  receiverCommand = "receiver"
+  receiverMessagesPath = "/messages"
+  receiverStatsPath = "/stats"
+  receiverFailuresPath = "/failures"
+)
+
+/* receivedMessage is a line received by the receiver, with the X-Sumo-* headers of its request. */
+type receivedMessage struct {
+  Message string `json:"message"`
+  Category string `json:"category"`
+  Name string `json:"name"`
+  Host string `json:"host"`
+  Client string `json:"client"`
+  Path string `json:"path"`
+  Time time.Time `json:"time"`
+}
+
+/* receiverFailures configures the failures injected by the receiver. Durations are strings such as "2s". */
+type receiverFailures struct {
+  /* The status of the failed requests, e.g. 500, 429 or 413; 0 means no failures. */
+  Status int `json:"status"`
+  /* The number of requests to fail; 0 means all of them, until the failures are cleared. */
+  Count int `json:"count"`
+  /* The Retry-After header of the failed requests, rounded to seconds. */
+  RetryAfter string `json:"retryAfter,omitempty"`
+  /* The delay before responding to each request. */
+  Latency string `json:"latency,omitempty"`
+  /* Requests with larger bodies are rejected with 413; 0 means no limit. */
+  MaxBodySize int64 `json:"maxBodySize,omitempty"`
+
+  retryAfter time.Duration
+  latency time.Duration
+}
+
+type receiverStats struct {
+  Requests int `json:"requests"`
+  Failed int `json:"failed"`
+  Messages int `json:"messages"`
+}
+
+/* sumoReceiver stands in for a Sumo HTTP source: it accepts the POSTs of the driver on any path
+  and stores their messages, which can then be queried, and it can inject failures. */
+type sumoReceiver struct {
+  mu sync.Mutex
+  messages []receivedMessage
+  stats receiverStats
+  failures receiverFailures
+  mux *http.ServeMux
+}
+
+func newSumoReceiver(failures receiverFailures) (*sumoReceiver, error) {
+  receiver := &sumoReceiver{}
+  if err := receiver.setFailures(failures); err != nil {
+    return nil, err
+  }
+  receiver.mux = http.NewServeMux()
+  receiver.mux.HandleFunc(receiverMessagesPath, receiver.messagesHandler)
+  receiver.mux.HandleFunc(receiverStatsPath, receiver.statsHandler)
+  receiver.mux.HandleFunc(receiverFailuresPath, receiver.failuresHandler)
+  receiver.mux.HandleFunc("/", receiver.receiveHandler)
+  return receiver, nil
+}
+
+func (receiver *sumoReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  receiver.mux.ServeHTTP(w, r)
+}
+
+func (receiver *sumoReceiver) setFailures(failures receiverFailures) error {
+  var err error
+  if failures.RetryAfter != "" {
+    if failures.retryAfter, err = parseDurationPositive("retryAfter", failures.RetryAfter); err != nil {
+      return err
+    }
+  }
+  if failures.Latency != "" {
+    if failures.latency, err = parseDurationPositive("latency", failures.Latency); err != nil {
+      return err
+    }
+  }
+  if failures.Status != 0 && (failures.Status < 400 || failures.Status > 599) {
+    return fmt.Errorf("status must be an HTTP error status, got %d", failures.Status)
+  }
+  if failures.Count < 0 || failures.MaxBodySize < 0 {
+    return fmt.Errorf("count and maxBodySize must not be negative")
+  }
+  receiver.mu.Lock()
+  receiver.failures = failures
+  receiver.mu.Unlock()
+  return nil
+}
+
+/* failure returns the status the request must fail with, if any, counting the injected failures. */
+func (receiver *sumoReceiver) failure(bodySize int64) (int, time.Duration) {
+  receiver.mu.Lock()
+  defer receiver.mu.Unlock()
+  receiver.stats.Requests++
+  failures := &receiver.failures
+  if failures.MaxBodySize > 0 && bodySize > failures.MaxBodySize {
+    receiver.stats.Failed++
+    return http.StatusRequestEntityTooLarge, 0
+  }
+  if failures.Status == 0 {
+    return 0, 0
+  }
+  status := failures.Status
+  if failures.Count > 0 {
+    failures.Count--
+    if failures.Count == 0 {
+      /* the last injected failure, the next requests succeed */
+      failures.Status = 0
+    }
+  }
+  receiver.stats.Failed++
+  return status, failures.retryAfter
+}
+
+func (receiver *sumoReceiver) receiveHandler(w http.ResponseWriter, r *http.Request) {
+  receiver.mu.Lock()
+  latency := receiver.failures.latency
+  receiver.mu.Unlock()
+  if latency > 0 {
+    time.Sleep(latency)
+  }
+  if r.Method != "POST" {
+    /* e.g. the connection checks of validate */
+    w.WriteHeader(http.StatusOK)
+    return
+  }
+  body, err := ioutil.ReadAll(r.Body)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  if status, retryAfter := receiver.failure(int64(len(body))); status != 0 {
+    if retryAfter > 0 {
+      w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second)))
+    }
+    http.Error(w, http.StatusText(status), status)
+    return
+  }
+  decoded, err := decodeRequestBody(r.Header.Get("Content-Encoding"), bytes.NewReader(body))
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  defer decoded.Close()
+  now := time.Now()
+  var messages []receivedMessage
+  scanner := bufio.NewScanner(decoded)
+  scanner.Buffer(make([]byte, 64 * 1024), fileReaderMaxSize)
+  for scanner.Scan() {
+    messages = append(messages, receivedMessage{
+      Message: scanner.Text(),
+      Category: r.Header.Get("X-Sumo-Category"),
+      Name: r.Header.Get("X-Sumo-Name"),
+      Host: r.Header.Get("X-Sumo-Host"),
+      Client: r.Header.Get("X-Sumo-Client"),
+      Path: r.URL.Path,
+      Time: now,
+    })
+  }
+  if err := scanner.Err(); err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  receiver.mu.Lock()
+  receiver.messages = append(receiver.messages, messages...)
+  receiver.stats.Messages += len(messages)
+  receiver.mu.Unlock()
+  w.WriteHeader(http.StatusOK)
+}
+
+/* decodeRequestBody returns the body of a request decoded according to its Content-Encoding.
+  It must be closed, which frees the decoder, e.g. the goroutines and buffers of zstd. */
+func decodeRequestBody(contentEncoding string, body io.Reader) (io.ReadCloser, error) {
+  switch contentEncoding {
+  case "":
+    return ioutil.NopCloser(body), nil
+  case compressCodecGzip:
+    return gzip.NewReader(body)
+  case compressCodecDeflate:
+    return zlib.NewReader(body)
+  case compressCodecZstd:
+    decoder, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+    if err != nil {
+      return nil, err
+    }
+    return decoder.IOReadCloser(), nil
+  default:
+    return nil, fmt.Errorf("unsupported Content-Encoding %q", contentEncoding)
+  }
+}
+
+/* query returns the messages matching the non empty filters. */
+func (receiver *sumoReceiver) query(category string, name string, host string, contains string) []receivedMessage {
+  receiver.mu.Lock()
+  defer receiver.mu.Unlock()
+  messages := []receivedMessage{}
+  for _, message := range receiver.messages {
+    if (category == "" || message.Category == category) &&
+      (name == "" || message.Name == name) &&
+      (host == "" || message.Host == host) &&
+      strings.Contains(message.Message, contains) {
+      messages = append(messages, message)
+    }
+  }
+  return messages
+}
+
+/* messagesHandler returns the received messages, filtered by the category, name, host and contains
+  query parameters, or clears them on DELETE. */
+func (receiver *sumoReceiver) messagesHandler(w http.ResponseWriter, r *http.Request) {
+  switch r.Method {
+  case "GET":
+    query := r.URL.Query()
+    messages := receiver.query(query.Get("category"), query.Get("name"), query.Get("host"), query.Get("contains"))
+    respondJson(w, map[string]interface{}{
+      "count": len(messages),
+      "messages": messages,
+    })
+  case "DELETE":
+    receiver.mu.Lock()
+    receiver.messages = nil
+    receiver.stats = receiverStats{}
+    receiver.mu.Unlock()
+    w.WriteHeader(http.StatusNoContent)
+  default:
+    http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+  }
+}
+
+func (receiver *sumoReceiver) statsHandler(w http.ResponseWriter, r *http.Request) {
+  receiver.mu.Lock()
+  stats := receiver.stats
+  receiver.mu.Unlock()
+  respondJson(w, stats)
+}
+
+/* failuresHandler returns the injected failures, replaces them on PUT or POST, or clears them on DELETE. */
+func (receiver *sumoReceiver) failuresHandler(w http.ResponseWriter, r *http.Request) {
+  switch r.Method {
+  case "GET":
+  case "PUT", "POST":
+    var failures receiverFailures
+    if err := json.NewDecoder(r.Body).Decode(&failures); err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+    if err := receiver.setFailures(failures); err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+  case "DELETE":
+    receiver.setFailures(receiverFailures{})
+  default:
+    http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+    return
+  }
+  receiver.mu.Lock()
+  failures := receiver.failures
+  receiver.mu.Unlock()
+  respondJson(w, failures)
+}
+
+func respondJson(w http.ResponseWriter, value interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(w).Encode(value)
+}
+
+/* runReceiver serves a receiver until it fails, returning the exit code. */
+func runReceiver(args []string, output io.Writer) int {
+  flags := flag.NewFlagSet(receiverCommand, flag.ContinueOnError)
+  flags.SetOutput(output)
+  listen := flags.String("listen", "127.0.0.1:8080", "address to listen on")
+  var failures receiverFailures
+  flags.IntVar(&failures.Status, "fail-status", 0, "status of the injected failures, e.g. 500, 429 or 413")
+  flags.IntVar(&failures.Count, "fail-count", 0, "number of requests to fail, 0 for all of them")
+  flags.StringVar(&failures.RetryAfter, "retry-after", "", "Retry-After of the injected failures, e.g. 2s")
+  flags.StringVar(&failures.Latency, "latency", "", "delay before responding to each request, e.g. 200ms")
+  maxBodySize := flags.String("max-body-size", "", "reject larger request bodies with 413, e.g. 1MB")
+  if err := flags.Parse(args); err != nil {
+    return 2
+  }
+  if flags.NArg() > 0 {
+    fmt.Fprintf(output, "Usage: docker-logging-driver %s [--listen address] [--fail-status status] ...\n", receiverCommand)
+    flags.PrintDefaults()
+    return 2
+  }
+  if *maxBodySize != "" {
+    size, err := parseSize("max-body-size", *maxBodySize)
+    if err != nil {
+      fmt.Fprintf(output, "error: %v\n", err)
+      return 2
+    }
+    failures.MaxBodySize = int64(size)
+  }
+  receiver, err := newSumoReceiver(failures)
+  if err != nil {
+    fmt.Fprintf(output, "error: %v\n", err)
+    return 2
+  }
+  fmt.Fprintf(output, "Receiving logs on http://%s/receiver/v1/http/<token>\n", *listen)
+  if err := http.ListenAndServe(*listen, receiver); err != nil {
+    fmt.Fprintf(output, "error: %v\n", err)
+    return 1
+  }
+  return 0
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func queryReceiver(t *testing.T, serverUrl string, query string) []receivedMessage {
+  response, err := http.Get(serverUrl + receiverMessagesPath + query)
+  assert.Nil(t, err)
+  defer response.Body.Close()
+  var result struct {
+    Count int
+    Messages []receivedMessage
+  }
+  assert.Nil(t, json.NewDecoder(response.Body).Decode(&result))
+  assert.Equal(t, result.Count, len(result.Messages))
+  return result.Messages
+}
+
+func setReceiverFailures(t *testing.T, serverUrl string, failures string) *http.Response {
+  response, err := http.Post(serverUrl + receiverFailuresPath, "application/json", bytes.NewBufferString(failures))
+  assert.Nil(t, err)
+  response.Body.Close()
+  return response
+}
+
+func TestSumoReceiver(t *testing.T) {
+  receiver, err := newSumoReceiver(receiverFailures{})
+  assert.Nil(t, err)
+  server := httptest.NewServer(receiver)
+  defer server.Close()
+  httpSourceUrl := server.URL + "/receiver/v1/http/token"
+
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: httpSourceUrl,
+    httpClient: &http.Client{},
+    gzipCompression: true,
+    gzipCompressionLevel: defaultGzipCompressionLevel,
+    sourceCategory: "category",
+    sourceName: "name",
+    sourceHost: "host",
+  }
+  otherSumoLogger := &sumoLogger{
+    httpSourceUrl: httpSourceUrl,
+    httpClient: &http.Client{},
+    sourceCategory: "other",
+  }
+
+  t.Run("receive messages", func(t *testing.T) {
+    assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: []byte("first")}, {line: []byte("second")}}))
+    assert.Nil(t, otherSumoLogger.sendLogs([]*sumoLog{{line: []byte("third")}}))
+
+    messages := queryReceiver(t, server.URL, "")
+    assert.Equal(t, 3, len(messages), "should store every message")
+
+    messages = queryReceiver(t, server.URL, "?category=category&name=name&host=host")
+    assert.Equal(t, 2, len(messages), "should filter by the X-Sumo-* headers")
+    assert.Equal(t, "first", messages[0].Message, "should decompress gzip bodies")
+    assert.Equal(t, "docker-logging-driver", messages[0].Client)
+    assert.Equal(t, "/receiver/v1/http/token", messages[0].Path)
+
+    messages = queryReceiver(t, server.URL, "?category=other&contains=thi")
+    assert.Equal(t, 1, len(messages), "should filter by category and content")
+    assert.Equal(t, "third", messages[0].Message)
+  })
+
+  t.Run("clear messages", func(t *testing.T) {
+    request, _ := http.NewRequest("DELETE", server.URL + receiverMessagesPath, nil)
+    response, err := http.DefaultClient.Do(request)
+    assert.Nil(t, err)
+    response.Body.Close()
+    assert.Equal(t, 0, len(queryReceiver(t, server.URL, "")), "should clear the messages")
+  })
+
+  t.Run("inject failures", func(t *testing.T) {
+    response := setReceiverFailures(t, server.URL, `{"status": 429, "count": 2, "retryAfter": "1500ms"}`)
+    assert.Equal(t, http.StatusOK, response.StatusCode)
+
+    for i := 0; i < 2; i++ {
+      response, err := http.Post(httpSourceUrl, "text/plain", bytes.NewBufferString("rejected"))
+      assert.Nil(t, err)
+      response.Body.Close()
+      assert.Equal(t, http.StatusTooManyRequests, response.StatusCode, "should fail the first requests")
+      assert.Equal(t, "2", response.Header.Get("Retry-After"), "should round Retry-After up to seconds")
+    }
+    assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: []byte("accepted")}}), "should succeed after count failures")
+    messages := queryReceiver(t, server.URL, "")
+    assert.Equal(t, 1, len(messages), "should not store the messages of failed requests")
+    assert.Equal(t, "accepted", messages[0].Message)
+
+    response = setReceiverFailures(t, server.URL, `{"status": 500}`)
+    assert.Equal(t, http.StatusOK, response.StatusCode)
+    for i := 0; i < 3; i++ {
+      assert.NotNil(t, testSumoLogger.sendLogs([]*sumoLog{{line: []byte("failed")}}), "should fail until cleared")
+    }
+    request, _ := http.NewRequest("DELETE", server.URL + receiverFailuresPath, nil)
+    response, err := http.DefaultClient.Do(request)
+    assert.Nil(t, err)
+    response.Body.Close()
+    assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: []byte("accepted")}}), "should succeed once cleared")
+  })
+
+  t.Run("body too large", func(t *testing.T) {
+    setReceiverFailures(t, server.URL, `{"maxBodySize": 10}`)
+    defer setReceiverFailures(t, server.URL, `{}`)
+    err := otherSumoLogger.sendLogs([]*sumoLog{{line: []byte("this line is too large")}})
+    assert.Contains(t, err.Error(), "413", "should reject large bodies")
+    assert.Nil(t, otherSumoLogger.sendLogs([]*sumoLog{{line: []byte("small")}}), "should accept small bodies")
+  })
+
+  t.Run("invalid failures", func(t *testing.T) {
+    response := setReceiverFailures(t, server.URL, `{"status": 200}`)
+    assert.Equal(t, http.StatusBadRequest, response.StatusCode, "should only inject error statuses")
+    response = setReceiverFailures(t, server.URL, `{"latency": "soon"}`)
+    assert.Equal(t, http.StatusBadRequest, response.StatusCode, "should reject invalid durations")
+  })
+
+  t.Run("stats", func(t *testing.T) {
+    response, err := http.Get(server.URL + receiverStatsPath)
+    assert.Nil(t, err)
+    defer response.Body.Close()
+    var stats receiverStats
+    assert.Nil(t, json.NewDecoder(response.Body).Decode(&stats))
+    assert.Equal(t, 9, stats.Requests, "should count the requests since the messages were cleared")
+    assert.Equal(t, 6, stats.Failed, "should count the failed requests")
+    assert.Equal(t, 3, stats.Messages, "should count the stored messages")
+  })
+}
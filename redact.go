@@ -0,0 +1,73 @@
+package main
+
+import (
+  "net/url"
+  "strings"
+)
+
+const (
+  redactedMask = "****"
+  /* The number of trailing characters of a token left visible, to tell tokens apart. */
+  redactedSuffixLength = 4
+  /* The mask of the password of a URL, as url.URL.Redacted writes it since Go 1.15. */
+  redactedPassword = "xxxxx"
+)
+
+/* redactSecret masks a secret, keeping only its last few characters if it's long enough for that
+  not to give it away. */
+func redactSecret(secret string) string {
+  if len(secret) < 4 * redactedSuffixLength {
+    return redactedMask
+  }
+  return redactedMask + secret[len(secret) - redactedSuffixLength:]
+}
+
+/* redactUrl masks the collector token of an HTTP source URL, which is its last path segment,
+  as well as the password and query, if any. The scheme and host are kept for troubleshooting. */
+func redactUrl(rawUrl string) string {
+  parsedUrl, err := url.Parse(rawUrl)
+  if err != nil {
+    /* keep what looks like the scheme and host of an invalid URL */
+    if i := strings.Index(rawUrl, "://"); i >= 0 && !strings.Contains(rawUrl[:i], " ") {
+      if j := strings.Index(rawUrl[i + 3:], "/"); j >= 0 && !strings.Contains(rawUrl[i + 3:i + 3 + j], "@") {
+        return rawUrl[:i + 3 + j + 1] + redactSecret(rawUrl[i + 3 + j + 1:])
+      }
+    }
+    return redactSecret(rawUrl)
+  }
+  if parsedUrl.Host == "" {
+    return redactSecret(rawUrl)
+  }
+  redactedUrl := &url.URL{
+    Scheme: parsedUrl.Scheme,
+    User: parsedUrl.User,
+    Host: parsedUrl.Host,
+  }
+  if parsedUrl.User != nil {
+    if _, hasPassword := parsedUrl.User.Password(); hasPassword {
+      redactedUrl.User = url.UserPassword(parsedUrl.User.Username(), redactedPassword)
+    }
+  }
+  path := strings.TrimSuffix(parsedUrl.EscapedPath(), "/")
+  if i := strings.LastIndex(path, "/"); i >= 0 && i < len(path) - 1 {
+    path = path[:i + 1] + redactSecret(path[i + 1:])
+  }
+  redacted := redactedUrl.String() + path
+  if parsedUrl.RawQuery != "" {
+    redacted += "?" + redactedMask
+  }
+  return redacted
+}
+
+/* redactUrlError masks the URL carried by errors of the http client and url parser,
+  which would otherwise end up in the daemon logs with the collector token. */
+func redactUrlError(err error) error {
+  if urlErr, ok := err.(*url.Error); ok {
+    return &url.Error{
+      Op: urlErr.Op,
+      URL: redactUrl(urlErr.URL),
+      Err: urlErr.Err,
+    }
+  }
+  return err
+}
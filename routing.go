@@ -0,0 +1,101 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net/url"
+  "regexp"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+)
+
+/* A routing rule, as configured in sumo-routes or sumo-routes-file. */
+type sumoRouteConfig struct {
+  Match string `json:"match"`
+  Stream string `json:"stream"`
+  Category string `json:"category"`
+  Url string `json:"url"`
+}
+
+/* sumoRoute sends the lines it matches to a different source category and/or HTTP source.
+  Lines of each route are batched separately, since the category and URL are set per request. */
+type sumoRoute struct {
+  match *regexp.Regexp
+  stream string
+  sourceCategory string
+  httpSourceUrl string
+}
+
+func (route *sumoRoute) matches(log *sumoLog) bool {
+  if route.stream != "" && route.stream != log.source {
+    return false
+  }
+  return route.match == nil || route.match.Match(log.line)
+}
+
+/* routeFor returns the first route matching the log, or nil if the log uses the default route.
+  A dedup summary takes the route of the line it repeats. */
+func (sumoLogger *sumoLogger) routeFor(log *sumoLog) *sumoRoute {
+  if log.repeats != nil {
+    log = log.repeats
+  }
+  for _, route := range sumoLogger.routes {
+    if route.matches(log) {
+      return route
+    }
+  }
+  return nil
+}
+
+/* parseLogOptRoutes parses the ordered routing rules, given either inline as JSON or as the path to a JSON file. */
+func parseLogOptRoutes(info logger.Info, dictionary map[string]string) ([]*sumoRoute, error) {
+  var routeConfigs []sumoRouteConfig
+  if input, exists := info.Config[logOptRoutes]; exists {
+    if err := json.Unmarshal([]byte(input), &routeConfigs); err != nil {
+      return nil, errors.Wrapf(err, "%s: failed to parse value of %s", pluginName, logOptRoutes)
+    }
+  }
+  if routesPath, exists := info.Config[logOptRoutesFile]; exists {
+    input, err := ioutil.ReadFile(routesPath)
+    if err != nil {
+      return nil, err
+    }
+    var fileRouteConfigs []sumoRouteConfig
+    if err := json.Unmarshal(input, &fileRouteConfigs); err != nil {
+      return nil, errors.Wrapf(err, "%s: failed to parse routes file %q", pluginName, routesPath)
+    }
+    routeConfigs = append(routeConfigs, fileRouteConfigs...)
+  }
+
+  var routes []*sumoRoute
+  for i, routeConfig := range routeConfigs {
+    if routeConfig.Match == "" && routeConfig.Stream == "" {
+      return nil, fmt.Errorf("%s: route %d must have a match pattern or a stream", pluginName, i + 1)
+    }
+    if routeConfig.Category == "" && routeConfig.Url == "" {
+      return nil, fmt.Errorf("%s: route %d must have a category or a url", pluginName, i + 1)
+    }
+    route := &sumoRoute{
+      stream: routeConfig.Stream,
+      sourceCategory: interpretAll(metadataPattern, routeConfig.Category, dictionary),
+    }
+    if routeConfig.Match != "" {
+      match, err := regexp.Compile(routeConfig.Match)
+      if err != nil {
+        return nil, errors.Wrapf(err, "%s: route %d has an invalid match pattern", pluginName, i + 1)
+      }
+      route.match = match
+    }
+    if routeConfig.Url != "" {
+      routeUrl, err := url.Parse(routeConfig.Url)
+      if err != nil || routeUrl.Scheme == fileSinkScheme {
+        return nil, fmt.Errorf("%s: route %d must have a valid HTTP source url", pluginName, i + 1)
+      }
+      route.httpSourceUrl = routeUrl.String()
+    }
+    routes = append(routes, route)
+  }
+  return routes, nil
+}
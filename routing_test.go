@@ -0,0 +1,141 @@
+package main
+
+import (
+  "bytes"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+const (
+  testRoutesFilePath = "/tmp/sumo-routes.json"
+  testRouteHttpSourceUrl = "https://example.org/audit"
+)
+
+type mockRecordingHttpClient struct {
+  requests chan *http.Request
+}
+
+func (m *mockRecordingHttpClient) Do(req *http.Request) (*http.Response, error) {
+  m.requests <- req
+  return &http.Response{
+      Body: ioutil.NopCloser(bytes.NewBuffer(nil)),
+      StatusCode: http.StatusOK,
+    }, nil
+}
+
+func NewMockRecordingHttpClient() *mockRecordingHttpClient {
+  return &mockRecordingHttpClient{
+    requests: make(chan *http.Request, defaultQueueSizeItems),
+  }
+}
+
+func TestParseLogOptRoutes(t *testing.T) {
+  dictionary := map[string]string{
+    "tag": "testTag",
+  }
+
+  t.Run("inline and file routes", func(t *testing.T) {
+    err := ioutil.WriteFile(testRoutesFilePath, []byte(`[{"stream": "stderr", "category": "errors"}]`), 0600)
+    assert.Nil(t, err)
+    defer os.Remove(testRoutesFilePath)
+
+    info := logger.Info{
+      Config: map[string]string{
+        logOptRoutes: `[{"match": "^AUDIT", "category": "audit/{{Tag}}", "url": "` + testRouteHttpSourceUrl + `"}]`,
+        logOptRoutesFile: testRoutesFilePath,
+      },
+    }
+    routes, err := parseLogOptRoutes(info, dictionary)
+    assert.Nil(t, err)
+    assert.Equal(t, 2, len(routes), "should have inline routes followed by file routes")
+    assert.Equal(t, "audit/testTag", routes[0].sourceCategory, "should interpret the tag in the category")
+    assert.Equal(t, testRouteHttpSourceUrl, routes[0].httpSourceUrl, "should have the route url")
+    assert.Equal(t, "stderr", routes[1].stream, "should have the route stream")
+    assert.Equal(t, "errors", routes[1].sourceCategory, "should have the route category")
+  })
+
+  t.Run("no routes", func(t *testing.T) {
+    routes, err := parseLogOptRoutes(logger.Info{Config: map[string]string{}}, dictionary)
+    assert.Nil(t, err)
+    assert.Equal(t, 0, len(routes), "should have no routes")
+  })
+
+  for name, input := range map[string]string{
+    "bad json": `[{"match": `,
+    "bad pattern": `[{"match": "(", "category": "audit"}]`,
+    "no match": `[{"category": "audit"}]`,
+    "no destination": `[{"match": "^AUDIT"}]`,
+    "file url": `[{"match": "^AUDIT", "url": "file:///tmp/audit"}]`,
+  } {
+    t.Run(name, func(t *testing.T) {
+      info := logger.Info{
+        Config: map[string]string{
+          logOptRoutes: input,
+        },
+      }
+      _, err := parseLogOptRoutes(info, dictionary)
+      assert.Error(t, err, "invalid routes should return an error")
+    })
+  }
+}
+
+func TestRouting(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  info := logger.Info{
+    Config: map[string]string{
+      logOptRoutes: `[{"match": "^AUDIT", "category": "audit", "url": "` + testRouteHttpSourceUrl + `"},
+        {"stream": "stderr", "category": "errors"}]`,
+    },
+  }
+  routes, err := parseLogOptRoutes(info, nil)
+  assert.Nil(t, err)
+
+  testAuditLog := &sumoLog{source: "stdout", line: []byte("AUDIT user logged in")}
+  testErrorLog := &sumoLog{source: "stderr", line: []byte("connection refused")}
+  testDefaultLog := &sumoLog{source: "stdout", line: testLine}
+
+  testClient := NewMockRecordingHttpClient()
+  testLogQueue := make(chan *sumoLog, defaultQueueSizeItems)
+  testSumoLogger := &sumoLogger{
+    httpSourceUrl: testHttpSourceUrl,
+    httpClient: testClient,
+    logQueue: testLogQueue,
+    logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+    sendingInterval: time.Hour,
+    batchSize: defaultBatchSizeBytes,
+    sourceCategory: "app",
+    routes: routes,
+  }
+
+  assert.Equal(t, routes[0], testSumoLogger.routeFor(testAuditLog), "should match the first route")
+  assert.Equal(t, routes[1], testSumoLogger.routeFor(testErrorLog), "should match the second route")
+  assert.Nil(t, testSumoLogger.routeFor(testDefaultLog), "should use the default route")
+  assert.Equal(t, routes[0], testSumoLogger.routeFor(&sumoLog{line: []byte("summary"), repeats: testAuditLog}),
+    "dedup summary, should take the route of the repeated line")
+
+  go testSumoLogger.batchLogs()
+  go testSumoLogger.handleBatchedLogs()
+  testLogQueue <- testAuditLog
+  testLogQueue <- testErrorLog
+  testLogQueue <- testDefaultLog
+  testLogQueue <- testErrorLog
+  close(testLogQueue)
+
+  requests := make(map[string]*http.Request)
+  for i := 0; i < 3; i++ {
+    request := <-testClient.requests
+    requests[request.Header.Get("X-Sumo-Category")] = request
+  }
+  assert.Equal(t, testRouteHttpSourceUrl, requests["audit"].URL.String(), "should send the routed batch to the route url")
+  assert.Equal(t, testHttpSourceUrl, requests["errors"].URL.String(), "should send the routed batch to the default url")
+  assert.Equal(t, testHttpSourceUrl, requests["app"].URL.String(), "should send the default batch to the default url")
+  errorLogs, _ := ioutil.ReadAll(requests["errors"].Body)
+  assert.Equal(t, "connection refused\nconnection refused\n", string(errorLogs), "should batch the lines of each route together")
+}
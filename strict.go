@@ -0,0 +1,295 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  /* The maximum edit distance of a known log option from an unknown one, to suggest it. */
+  maxSuggestionDistance = 3
+)
+
+type logOptValidator func(logOptKey string, input string) error
+
+func validateIntPositive(logOptKey string, input string) error {
+  _, err := parseIntPositive(logOptKey, input)
+  return err
+}
+
+func validateIntOrZero(logOptKey string, input string) error {
+  _, err := parseIntOrZero(logOptKey, input)
+  return err
+}
+
+func validateSize(logOptKey string, input string) error {
+  _, err := parseSize(logOptKey, input)
+  return err
+}
+
+func validateSizeOrZero(logOptKey string, input string) error {
+  _, err := parseSizeOrZero(logOptKey, input)
+  return err
+}
+
+func validateDuration(logOptKey string, input string) error {
+  _, err := parseDurationPositive(logOptKey, input)
+  return err
+}
+
+func validateBoolean(logOptKey string, input string) error {
+  _, err := parseBoolean(logOptKey, input)
+  return err
+}
+
+func validateGzipCompressionLevel(logOptKey string, input string) error {
+  if isAutoCompressionLevel(input) {
+    return nil
+  }
+  _, err := parseGzipCompressionLevel(logOptKey, input)
+  return err
+}
+
+func validateCpuBudget(logOptKey string, input string) error {
+  _, err := parseCpuBudget(logOptKey, input)
+  return err
+}
+
+func validateCompressCodec(logOptKey string, input string) error {
+  _, err := parseCompressCodec(logOptKey, input)
+  return err
+}
+
+func validateOversizeMode(logOptKey string, input string) error {
+  _, err := parseOversizeMode(logOptKey, input)
+  return err
+}
+
+func validateTimestampMode(logOptKey string, input string) error {
+  _, err := parseTimestampMode(logOptKey, input)
+  return err
+}
+
+func validateTimestampLayout(logOptKey string, input string) error {
+  _, err := parseTimestampLayout(logOptKey, input)
+  return err
+}
+
+func validateFlushMatch(logOptKey string, input string) error {
+  _, err := parseFlushMatch(logOptKey, input)
+  return err
+}
+
+func validateStream(logOptKey string, input string) error {
+  if input != "stdout" && input != "stderr" {
+    return fmt.Errorf("%s must be stdout or stderr, got '%s'", logOptKey, input)
+  }
+  return nil
+}
+
+func validateUrls(logOptKey string, input string) error {
+  if len(parseUrls(input, logOptKey)) == 0 {
+    return fmt.Errorf("%s must be a valid URL", logOptKey)
+  }
+  return nil
+}
+
+func validateTlsVersion(logOptKey string, input string) error {
+  _, err := parseTlsVersion(logOptKey, input)
+  return err
+}
+
+func validateTlsCipherSuites(logOptKey string, input string) error {
+  _, err := parseTlsCipherSuites(input)
+  return err
+}
+
+func validateSpkiPins(logOptKey string, input string) error {
+  _, err := parseSpkiPins(input)
+  return err
+}
+
+/* The known log options of the plugin, with the validator of their values, if any. */
+var logOptValidators = map[string]logOptValidator{
+  logOptUrl: validateUrls,
+  logOptUrlFile: nil,
+  logOptUrlEnv: nil,
+  logOptUrlReloadInterval: validateDuration,
+  logOptProfile: nil,
+  logOptProfilesFile: nil,
+  logOptStrict: validateBoolean,
+  logOptGzipCompression: validateBoolean,
+  logOptGzipCompressionLevel: validateGzipCompressionLevel,
+  logOptCompressCodec: validateCompressCodec,
+  logOptCompressCpuBudget: validateCpuBudget,
+  logOptCompressMinSize: validateSizeOrZero,
+  logOptProxyUrl: validateUrls,
+  logOptProxyCredentialsFile: nil,
+  logOptNoProxy: nil,
+  logOptProxyConnectHeaders: nil,
+  logOptInsecureSkipVerify: validateBoolean,
+  logOptRootCaPath: nil,
+  logOptServerName: nil,
+  logOptClientCertPath: nil,
+  logOptClientKeyPath: nil,
+  logOptTlsMinVersion: validateTlsVersion,
+  logOptTlsMaxVersion: validateTlsVersion,
+  logOptTlsCipherSuites: validateTlsCipherSuites,
+  logOptTlsPinSha256: validateSpkiPins,
+  logOptTlsReloadInterval: validateDuration,
+  logOptSendingInterval: validateDuration,
+  logOptQueueSize: validateIntPositive,
+  logOptBatchSize: validateSize,
+  logOptBatchMaxLines: validateIntOrZero,
+  logOptBatchMaxAge: validateDuration,
+  logOptBatchMinSize: validateSizeOrZero,
+  logOptOversizeMode: validateOversizeMode,
+  logOptMaxFrameSize: validateSize,
+  logOptTimestamp: validateTimestampMode,
+  logOptTimestampLayout: validateTimestampLayout,
+  logOptFlushMatch: validateFlushMatch,
+  logOptFlushStream: validateStream,
+  logOptFlushMinInterval: validateDuration,
+  logOptSourceCategory: nil,
+  logOptSourceName: nil,
+  logOptSourceHost: nil,
+  logOptRoutes: nil,
+  logOptRoutesFile: nil,
+  logOptFailoverThreshold: validateIntPositive,
+  logOptFailbackInterval: validateDuration,
+  logOptFileMaxSize: validateSize,
+  logOptFileMaxFiles: validateIntPositive,
+  logOptDedup: validateBoolean,
+  logOptDedupWindow: validateDuration,
+  logOptDedupFuzzy: validateBoolean,
+}
+
+/* knownLogOpt returns the log option a key stands for, which is the key itself,
+  or the option of an additional destination for numbered keys such as sumo-url-2. */
+func knownLogOpt(logOptKey string) (string, bool) {
+  if _, exists := logOptValidators[logOptKey]; exists {
+    return logOptKey, true
+  }
+  if i := strings.LastIndex(logOptKey, "-"); i >= 0 {
+    if index, err := strconv.Atoi(logOptKey[i + 1:]); err == nil && index >= firstDestinationIndex {
+      for _, destinationLogOpt := range destinationLogOpts {
+        if destinationLogOpt == logOptKey[:i] {
+          return destinationLogOpt, true
+        }
+      }
+    }
+  }
+  return "", false
+}
+
+/* unknownLogOpts returns an error for each sumo-* log option the plugin doesn't know, e.g. because of a typo. */
+func unknownLogOpts(info logger.Info) []error {
+  var errs []error
+  for _, logOptKey := range sortedLogOptKeys(info) {
+    if !strings.HasPrefix(logOptKey, logOptPrefix) {
+      continue
+    }
+    if _, exists := knownLogOpt(logOptKey); exists {
+      continue
+    }
+    if suggestion := suggestLogOpt(logOptKey); suggestion != "" {
+      errs = append(errs, fmt.Errorf("unknown log-opt %s, did you mean %s?", logOptKey, suggestion))
+    } else {
+      errs = append(errs, fmt.Errorf("unknown log-opt %s", logOptKey))
+    }
+  }
+  return errs
+}
+
+/* invalidLogOpts returns an error for each log option whose value can't be parsed. */
+func invalidLogOpts(info logger.Info) []error {
+  var errs []error
+  for _, logOptKey := range sortedLogOptKeys(info) {
+    knownKey, exists := knownLogOpt(logOptKey)
+    if !exists || logOptValidators[knownKey] == nil {
+      continue
+    }
+    if err := logOptValidators[knownKey](logOptKey, info.Config[logOptKey]); err != nil {
+      errs = append(errs, err)
+    }
+  }
+  return errs
+}
+
+/* validateLogOpts checks the log options of a container. In strict mode, all the problems found are returned
+  as a single error, so the container fails to start; otherwise unknown options are only logged, and
+  invalid values fall back to their defaults when parsed. */
+func validateLogOpts(info logger.Info) error {
+  unknown := unknownLogOpts(info)
+  if !parseLogOptBoolean(info, logOptStrict, defaultStrict) {
+    for _, err := range unknown {
+      logrus.Warn(fmt.Sprintf("%s: %v", pluginName, err))
+    }
+    return nil
+  }
+  errs := append(unknown, invalidLogOpts(info)...)
+  if len(errs) == 0 {
+    return nil
+  }
+  var messages []string
+  for _, err := range errs {
+    messages = append(messages, strings.TrimPrefix(err.Error(), pluginName + ": "))
+  }
+  return fmt.Errorf("%s: invalid log options: %s", pluginName, strings.Join(messages, "; "))
+}
+
+func sortedLogOptKeys(info logger.Info) []string {
+  var keys []string
+  for key := range info.Config {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+/* suggestLogOpt returns the known log option closest to the unknown one, if it's close enough. */
+func suggestLogOpt(logOptKey string) string {
+  suggestion := ""
+  suggestionDistance := maxSuggestionDistance + 1
+  for knownKey := range logOptValidators {
+    if distance := editDistance(logOptKey, knownKey); distance < suggestionDistance ||
+      (distance == suggestionDistance && knownKey < suggestion) {
+      suggestion = knownKey
+      suggestionDistance = distance
+    }
+  }
+  return suggestion
+}
+
+/* editDistance returns the Levenshtein distance between two strings. */
+func editDistance(a string, b string) int {
+  previous := make([]int, len(b) + 1)
+  current := make([]int, len(b) + 1)
+  for j := range previous {
+    previous[j] = j
+  }
+  for i := 1; i <= len(a); i++ {
+    current[0] = i
+    for j := 1; j <= len(b); j++ {
+      cost := 1
+      if a[i - 1] == b[j - 1] {
+        cost = 0
+      }
+      current[j] = minInt(minInt(previous[j] + 1, current[j - 1] + 1), previous[j - 1] + cost)
+    }
+    previous, current = current, previous
+  }
+  return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+  if a < b {
+    return a
+  }
+  return b
+}
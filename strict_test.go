@@ -0,0 +1,119 @@
+package main
+
+import (
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+  for input, expected := range map[string]int{
+    "2000000": 2000000,
+    "2MB": 2000000,
+    "2 mb": 2000000,
+    "512KiB": 512 * 1024,
+    "1GiB": 1 << 30,
+    "100B": 100,
+  } {
+    size, err := parseSize(logOptBatchSize, input)
+    assert.Nil(t, err, "valid size %s, should not return an error", input)
+    assert.Equal(t, expected, size, "size of %s", input)
+  }
+  for _, input := range []string{"", "2XB", "MB", "-2MB", "0", "2.5MB", "100GiB"} {
+    _, err := parseSize(logOptBatchSize, input)
+    assert.Error(t, err, "invalid size %s, should return an error", input)
+  }
+  info := logger.Info{Config: map[string]string{logOptBatchSize: "2MB"}}
+  assert.Equal(t, 2000000, parseLogOptSize(info, logOptBatchSize, defaultBatchSizeBytes), "should parse the size with its unit")
+
+  for _, input := range []string{"0", "0KB", " 0 "} {
+    size, err := parseSizeOrZero(logOptCompressMinSize, input)
+    assert.Nil(t, err, "zero size %s, should be accepted where it disables a threshold", input)
+    assert.Equal(t, 0, size)
+  }
+  size, err := parseSizeOrZero(logOptCompressMinSize, "1KB")
+  assert.Nil(t, err)
+  assert.Equal(t, 1000, size)
+  for _, input := range []string{"", "0XB", "-1"} {
+    _, err := parseSizeOrZero(logOptCompressMinSize, input)
+    assert.Error(t, err, "invalid size %s, should return an error", input)
+  }
+}
+
+func TestParseIntOrZero(t *testing.T) {
+  for input, expected := range map[string]int{"0": 0, "500": 500} {
+    value, err := parseIntOrZero(logOptBatchMaxLines, input)
+    assert.Nil(t, err, "valid value %s, should not return an error", input)
+    assert.Equal(t, expected, value, "value of %s", input)
+  }
+  for _, input := range []string{"", "-1", "1.5", "ten"} {
+    _, err := parseIntOrZero(logOptBatchMaxLines, input)
+    assert.Error(t, err, "invalid value %s, should return an error", input)
+  }
+  _, err := parseIntPositive(logOptQueueSize, "0")
+  assert.Error(t, err, "zero is still invalid where it doesn't disable anything")
+}
+
+func TestValidateLogOpts(t *testing.T) {
+  t.Run("strict mode returns all errors", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptStrict: "true",
+        logOptUrl: testHttpSourceUrl,
+        "sumo-bach-size": "2MB",
+        "sumo-nonsense-option-name": "1",
+        logOptSendingInterval: "5",
+        logOptQueueSize: "-1",
+        logOptGzipCompressionLevel: "10",
+        logOptTlsMinVersion: "1.4",
+        destinationLogOptKey(logOptSourceCategory, 2): "other",
+        destinationLogOptKey(logOptFileMaxSize, 2): "big",
+        "tag": "{{.Name}}",
+      },
+    }
+    err := validateLogOpts(info)
+    assert.Error(t, err, "invalid log options in strict mode, should return an error")
+    message := err.Error()
+    assert.Contains(t, message, "unknown log-opt sumo-bach-size, did you mean sumo-batch-size?")
+    assert.Contains(t, message, "unknown log-opt sumo-nonsense-option-name;", "should not suggest a distant option")
+    assert.Contains(t, message, logOptSendingInterval)
+    assert.Contains(t, message, logOptQueueSize)
+    assert.Contains(t, message, logOptGzipCompressionLevel)
+    assert.Contains(t, message, logOptTlsMinVersion)
+    assert.Contains(t, message, destinationLogOptKey(logOptFileMaxSize, 2))
+    assert.NotContains(t, message, destinationLogOptKey(logOptSourceCategory, 2), "destination options should be known")
+    assert.NotContains(t, message, "tag", "should not check options of other drivers")
+  })
+
+  t.Run("strict mode with valid log options", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptStrict: "true",
+        logOptUrl: testHttpSourceUrl,
+        logOptBatchSize: "2MB",
+        logOptSendingInterval: "5s",
+        destinationLogOptKey(logOptUrlFile, 2): testUrlFilePath,
+      },
+    }
+    assert.Nil(t, validateLogOpts(info), "valid log options, should not return an error")
+  })
+
+  t.Run("non strict mode", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptUrl: testHttpSourceUrl,
+        "sumo-bach-size": "2MB",
+        logOptQueueSize: "-1",
+      },
+    }
+    assert.Nil(t, validateLogOpts(info), "not strict mode, should not return an error")
+  })
+}
+
+func TestEditDistance(t *testing.T) {
+  assert.Equal(t, 0, editDistance(logOptUrl, logOptUrl))
+  assert.Equal(t, 1, editDistance("sumo-bach-size", logOptBatchSize))
+  assert.Equal(t, 3, editDistance("kitten", "sitting"))
+  assert.Equal(t, logOptSourceCategory, suggestLogOpt("sumo-source-categroy"))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "strings"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  /* Lines are sent as they are, Sumo stamping them with the time they are received. */
+  timestampModeNone = "none"
+  /* Lines are sent after the time Docker read them, e.g. 2009-02-13T23:31:30.123456789Z line. */
+  timestampModePrefix = "prefix"
+  /* Lines are sent as JSON objects, with the time Docker read them and their stream. */
+  timestampModeJson = "json"
+)
+
+var timestampModes = []string{timestampModeNone, timestampModePrefix, timestampModeJson}
+
+/* Layouts of sumo-timestamp-layout that can be given by name, any other value being a Go time layout. */
+var timestampLayouts = map[string]string{
+  "rfc3339": time.RFC3339,
+  "rfc3339nano": time.RFC3339Nano,
+  "rfc1123z": time.RFC1123Z,
+}
+
+/* timestampedLog is a line in sumo-timestamp=json. */
+type timestampedLog struct {
+  Timestamp string `json:"timestamp"`
+  Stream string `json:"stream,omitempty"`
+  Log string `json:"log"`
+}
+
+func parseLogOptTimestampMode(info logger.Info, logOptKey string, defaultValue string) string {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseTimestampMode(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %s", pluginName, err, defaultValue))
+      return defaultValue
+    }
+    return inputValue
+  }
+  return defaultValue
+}
+
+func parseTimestampMode(logOptKey string, input string) (string, error) {
+  mode := strings.ToLower(strings.TrimSpace(input))
+  for _, timestampMode := range timestampModes {
+    if mode == timestampMode {
+      return mode, nil
+    }
+  }
+  return "", fmt.Errorf("Not supported mode '%s' for %s (supported values are %s)",
+    input, logOptKey, strings.Join(timestampModes, ", "))
+}
+
+func parseLogOptTimestampLayout(info logger.Info, logOptKey string, defaultValue string) string {
+  if input, exists := info.Config[logOptKey]; exists {
+    inputValue, err := parseTimestampLayout(logOptKey, input)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: %v. Using default %s", pluginName, err, defaultValue))
+      return defaultValue
+    }
+    return inputValue
+  }
+  return defaultValue
+}
+
+/* parseTimestampLayout returns the Go time layout of a layout name, e.g. RFC3339Nano, or of a custom layout. */
+func parseTimestampLayout(logOptKey string, input string) (string, error) {
+  if layout, exists := timestampLayouts[strings.ToLower(strings.TrimSpace(input))]; exists {
+    return layout, nil
+  }
+  /* a layout without any element of the reference time would print the same text for every line */
+  if time.Unix(0, 0).UTC().Format(input) == time.Unix(1234567890, 123456789).UTC().Format(input) {
+    return "", fmt.Errorf("%s must be RFC3339, RFC3339Nano, RFC1123Z or a Go time layout such as %s, got '%s'",
+      logOptKey, time.RFC3339, input)
+  }
+  return input, nil
+}
+
+/* stampLog returns the log with the time Docker read it added to its line, according to sumo-timestamp. */
+func (sumoLogger *sumoLogger) stampLog(log *sumoLog) *sumoLog {
+  if log.time.IsZero() {
+    return log
+  }
+  var line []byte
+  switch sumoLogger.timestampMode {
+  case timestampModePrefix:
+    timestamp := log.time.UTC().Format(sumoLogger.timestampLayout)
+    line = make([]byte, 0, len(timestamp) + 1 + len(log.line))
+    line = append(line, timestamp...)
+    line = append(line, ' ')
+    line = append(line, log.line...)
+  case timestampModeJson:
+    var err error
+    line, err = json.Marshal(&timestampedLog{
+      Timestamp: log.time.UTC().Format(sumoLogger.timestampLayout),
+      Stream: log.source,
+      Log: string(log.line),
+    })
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: Failed to add the timestamp to a log. %v", pluginName, err))
+      return log
+    }
+  default:
+    return log
+  }
+  stampedLog := *log
+  stampedLog.line = line
+  return &stampedLog
+}
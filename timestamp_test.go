@@ -0,0 +1,141 @@
+package main
+
+import (
+  "encoding/json"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/stretchr/testify/assert"
+)
+
+func TestParseTimestampLayout(t *testing.T) {
+  layout, err := parseTimestampLayout(logOptTimestampLayout, "RFC3339Nano")
+  assert.Nil(t, err)
+  assert.Equal(t, time.RFC3339Nano, layout, "layout name, should be its layout")
+
+  layout, err = parseTimestampLayout(logOptTimestampLayout, "2006-01-02 15:04:05.000")
+  assert.Nil(t, err)
+  assert.Equal(t, "2006-01-02 15:04:05.000", layout, "custom layout, should be kept")
+
+  _, err = parseTimestampLayout(logOptTimestampLayout, "")
+  assert.NotNil(t, err, "empty layout, should fail")
+  _, err = parseTimestampLayout(logOptTimestampLayout, "timestamp")
+  assert.NotNil(t, err, "layout without time elements, should fail")
+
+  info := logger.Info{Config: map[string]string{logOptTimestampLayout: "now"}}
+  assert.Equal(t, defaultTimestampLayout, parseLogOptTimestampLayout(info, logOptTimestampLayout, defaultTimestampLayout),
+    "invalid layout, should be default")
+}
+
+func TestParseTimestampMode(t *testing.T) {
+  for _, mode := range timestampModes {
+    parsed, err := parseTimestampMode(logOptTimestamp, mode)
+    assert.Nil(t, err)
+    assert.Equal(t, mode, parsed)
+  }
+  _, err := parseTimestampMode(logOptTimestamp, "suffix")
+  assert.NotNil(t, err, "unknown mode, should fail")
+}
+
+func TestStampLog(t *testing.T) {
+  testSumoLog := &sumoLog{
+    line: []byte(`say "hi"`),
+    source: testSource,
+    time: time.Unix(0, 1234567890123456789),
+  }
+
+  t.Run("none", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{timestampMode: timestampModeNone, timestampLayout: time.RFC3339Nano}
+    assert.Equal(t, testSumoLog, testSumoLogger.stampLog(testSumoLog))
+  })
+
+  t.Run("prefix", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{timestampMode: timestampModePrefix, timestampLayout: time.RFC3339Nano}
+    stampedLog := testSumoLogger.stampLog(testSumoLog)
+    assert.Equal(t, `2009-02-13T23:31:30.123456789Z say "hi"`, string(stampedLog.line))
+    assert.Equal(t, testSource, stampedLog.source, "should keep the source")
+    assert.Equal(t, `say "hi"`, string(testSumoLog.line), "should not modify the original line")
+  })
+
+  t.Run("custom layout", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{timestampMode: timestampModePrefix, timestampLayout: "2006-01-02 15:04:05.000"}
+    assert.Equal(t, `2009-02-13 23:31:30.123 say "hi"`, string(testSumoLogger.stampLog(testSumoLog).line))
+  })
+
+  t.Run("json", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{timestampMode: timestampModeJson, timestampLayout: time.RFC3339Nano}
+    var decoded timestampedLog
+    assert.Nil(t, json.Unmarshal(testSumoLogger.stampLog(testSumoLog).line, &decoded))
+    assert.Equal(t, timestampedLog{
+      Timestamp: "2009-02-13T23:31:30.123456789Z",
+      Stream: testSource,
+      Log: `say "hi"`,
+    }, decoded)
+  })
+
+  t.Run("unknown time", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{timestampMode: timestampModePrefix, timestampLayout: time.RFC3339Nano}
+    unknownTimeLog := &sumoLog{line: testLine}
+    assert.Equal(t, unknownTimeLog, testSumoLogger.stampLog(unknownTimeLog))
+  })
+
+  t.Run("in a batch", func(t *testing.T) {
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: testHttpSourceUrl,
+      logQueue: make(chan *sumoLog, defaultQueueSizeItems),
+      logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+      sendingInterval: time.Hour,
+      batchSize: defaultBatchSizeBytes,
+      timestampMode: timestampModePrefix,
+      timestampLayout: time.RFC3339,
+    }
+    go testSumoLogger.batchLogs()
+    testSumoLogger.logQueue <- testSumoLog
+    close(testSumoLogger.logQueue)
+    logBatch := <-testSumoLogger.logBatchQueue
+    assert.Equal(t, 1, len(logBatch.logs))
+    assert.Equal(t, `2009-02-13T23:31:30Z say "hi"`, string(logBatch.logs[0].line))
+    assert.Equal(t, len(logBatch.logs[0].line), logBatch.sizeBytes, "should count the timestamp in the batch size")
+  })
+
+  t.Run("oversize line", func(t *testing.T) {
+    oversizeLog := &sumoLog{
+      line: []byte(strings.Repeat(`"x" `, 50)),
+      source: testSource,
+      time: testSumoLog.time,
+    }
+    for _, mode := range []string{timestampModePrefix, timestampModeJson} {
+      for _, oversizeMode := range []string{oversizeModeTruncate, oversizeModeSplit} {
+        testSumoLogger := &sumoLogger{
+          logBatchQueue: make(chan *sumoLogBatch, defaultQueueSizeItems),
+          batchSize: 120,
+          oversizeMode: oversizeMode,
+          timestampMode: mode,
+          timestampLayout: time.RFC3339Nano,
+        }
+        logBatches := make(map[*sumoRoute]*sumoLogBatch)
+        testSumoLogger.addLogToBatch(logBatches, oversizeLog, time.Now())
+        testSumoLogger.pushBatchToQueue(logBatches[nil])
+        close(testSumoLogger.logBatchQueue)
+        var logs []*sumoLog
+        for logBatch := range testSumoLogger.logBatchQueue {
+          logs = append(logs, logBatch.logs...)
+        }
+        assert.NotEmpty(t, logs, "%s %s, should keep the line", mode, oversizeMode)
+        for _, log := range logs {
+          assert.True(t, len(log.line) <= testSumoLogger.batchSize,
+            "%s %s, stamped line of %d bytes should fit in the batch size", mode, oversizeMode, len(log.line))
+          if mode == timestampModeJson {
+            var decoded timestampedLog
+            assert.Nil(t, json.Unmarshal(log.line, &decoded), "%s, should stamp each part as json", oversizeMode)
+          } else {
+            assert.True(t, strings.HasPrefix(string(log.line), "2009-02-13T23:31:30.123456789Z "),
+              "%s, should stamp each part", oversizeMode)
+          }
+        }
+      }
+    }
+  })
+}
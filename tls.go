@@ -0,0 +1,288 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "crypto/tls"
+  "crypto/x509"
+  "encoding/base64"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+  "github.com/sirupsen/logrus"
+)
+
+func parseLogOptTlsConfig(info logger.Info) (*tls.Config, error) {
+  tlsConfig := &tls.Config{}
+  tlsConfig.InsecureSkipVerify = parseLogOptBoolean(info, logOptInsecureSkipVerify, defaultInsecureSkipVerify)
+  if rootCaPath, exists := info.Config[logOptRootCaPath]; exists {
+    rootCaPool, err := loadRootCaPool(rootCaPath)
+    if err != nil {
+      return nil, err
+    }
+    tlsConfig.RootCAs = rootCaPool
+  }
+  if serverName, exists := info.Config[logOptServerName]; exists {
+    tlsConfig.ServerName = serverName
+  }
+
+  clientCertPath, clientCertExists := info.Config[logOptClientCertPath]
+  clientKeyPath, clientKeyExists := info.Config[logOptClientKeyPath]
+  if clientCertExists != clientKeyExists {
+    return nil, fmt.Errorf("%s: %s and %s must be set together", pluginName, logOptClientCertPath, logOptClientKeyPath)
+  }
+  if clientCertExists {
+    clientCert, err := loadClientCertificate(clientCertPath, clientKeyPath)
+    if err != nil {
+      return nil, err
+    }
+    tlsConfig.Certificates = []tls.Certificate{clientCert}
+  }
+
+  if minVersion, exists := info.Config[logOptTlsMinVersion]; exists {
+    version, err := parseTlsVersion(logOptTlsMinVersion, minVersion)
+    if err != nil {
+      return nil, err
+    }
+    tlsConfig.MinVersion = version
+  }
+  if maxVersion, exists := info.Config[logOptTlsMaxVersion]; exists {
+    version, err := parseTlsVersion(logOptTlsMaxVersion, maxVersion)
+    if err != nil {
+      return nil, err
+    }
+    tlsConfig.MaxVersion = version
+  }
+  if tlsConfig.MinVersion != 0 && tlsConfig.MaxVersion != 0 && tlsConfig.MinVersion > tlsConfig.MaxVersion {
+    return nil, fmt.Errorf("%s: %s must not be greater than %s", pluginName, logOptTlsMinVersion, logOptTlsMaxVersion)
+  }
+  if cipherSuites, exists := info.Config[logOptTlsCipherSuites]; exists {
+    ids, err := parseTlsCipherSuites(cipherSuites)
+    if err != nil {
+      return nil, err
+    }
+    tlsConfig.CipherSuites = ids
+  }
+  if pins, exists := info.Config[logOptTlsPinSha256]; exists {
+    pinHashes, err := parseSpkiPins(pins)
+    if err != nil {
+      return nil, err
+    }
+    tlsConfig.VerifyPeerCertificate = verifySpkiPins(pinHashes, tlsConfig.InsecureSkipVerify)
+  }
+  return tlsConfig, nil
+}
+
+var tlsVersions = map[string]uint16{
+  "1.0": tls.VersionTLS10,
+  "1.1": tls.VersionTLS11,
+  "1.2": tls.VersionTLS12,
+  "1.3": tls.VersionTLS13,
+}
+
+func parseTlsVersion(logOptKey string, input string) (uint16, error) {
+  version, exists := tlsVersions[strings.TrimPrefix(strings.ToLower(strings.TrimSpace(input)), "tls")]
+  if !exists {
+    return 0, fmt.Errorf("%s: Not supported TLS version '%s' for %s (supported values are 1.0, 1.1, 1.2 and 1.3)",
+      pluginName, input, logOptKey)
+  }
+  return version, nil
+}
+
+/* parseTlsCipherSuites parses a comma separated list of cipher suite names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. */
+func parseTlsCipherSuites(input string) ([]uint16, error) {
+  supported := make(map[string]uint16)
+  for _, cipherSuite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+    supported[cipherSuite.Name] = cipherSuite.ID
+  }
+  var ids []uint16
+  for _, name := range strings.Split(input, ",") {
+    id, exists := supported[strings.TrimSpace(name)]
+    if !exists {
+      return nil, fmt.Errorf("%s: Not supported cipher suite '%s' for %s", pluginName, strings.TrimSpace(name), logOptTlsCipherSuites)
+    }
+    ids = append(ids, id)
+  }
+  return ids, nil
+}
+
+/* parseSpkiPins parses a comma separated list of base64 encoded SHA-256 hashes
+  of certificates' Subject Public Key Info, optionally prefixed with "sha256/". */
+func parseSpkiPins(input string) ([][]byte, error) {
+  var pinHashes [][]byte
+  for _, pin := range strings.Split(input, ",") {
+    pinHash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"))
+    if err != nil || len(pinHash) != sha256.Size {
+      return nil, fmt.Errorf("%s: Failed to parse pin '%s' for %s as a base64 encoded SHA-256 hash",
+        pluginName, strings.TrimSpace(pin), logOptTlsPinSha256)
+    }
+    pinHashes = append(pinHashes, pinHash)
+  }
+  return pinHashes, nil
+}
+
+/* verifySpkiPins returns a VerifyPeerCertificate hook accepting the connection only if
+  a certificate of the verified chains of the server matches one of the pins. The certificates presented
+  by the server are not verified, as it could add the pinned certificate to them, so without verification
+  only its own certificate, the first one, is checked. */
+func verifySpkiPins(pinHashes [][]byte, insecureSkipVerify bool) func([][]byte, [][]*x509.Certificate) error {
+  return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+    var certs []*x509.Certificate
+    for _, chain := range verifiedChains {
+      certs = append(certs, chain...)
+    }
+    if len(verifiedChains) == 0 && insecureSkipVerify && len(rawCerts) > 0 {
+      if leaf, err := x509.ParseCertificate(rawCerts[0]); err == nil {
+        certs = append(certs, leaf)
+      }
+    }
+    for _, cert := range certs {
+      spkiHash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+      for _, pinHash := range pinHashes {
+        if bytes.Equal(spkiHash[:], pinHash) {
+          return nil
+        }
+      }
+    }
+    return &permanentError{
+      err: fmt.Errorf("%s: no certificate of the server matches %s", pluginName, logOptTlsPinSha256),
+    }
+  }
+}
+
+func loadRootCaPool(rootCaPath string) (*x509.CertPool, error) {
+  rootCa, err := ioutil.ReadFile(rootCaPath)
+  if err != nil {
+    return nil, err
+  }
+  rootCaPool := x509.NewCertPool()
+  if !rootCaPool.AppendCertsFromPEM(rootCa) {
+    return nil, fmt.Errorf("%s: no PEM encoded certificates found in root certificate %q", pluginName, rootCaPath)
+  }
+  return rootCaPool, nil
+}
+
+/* loadClientCertificate loads a PEM encoded client certificate and key,
+  checking that they match and that the certificate has not expired. */
+func loadClientCertificate(certPath string, keyPath string) (tls.Certificate, error) {
+  certPem, err := ioutil.ReadFile(certPath)
+  if err != nil {
+    return tls.Certificate{}, errors.Wrapf(err, "%s: failed to read client certificate", pluginName)
+  }
+  keyPem, err := ioutil.ReadFile(keyPath)
+  if err != nil {
+    return tls.Certificate{}, errors.Wrapf(err, "%s: failed to read client key", pluginName)
+  }
+  clientCert, err := tls.X509KeyPair(certPem, keyPem)
+  if err != nil {
+    return tls.Certificate{}, errors.Wrapf(err, "%s: invalid client certificate %q or key %q",
+      pluginName, certPath, keyPath)
+  }
+  leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+  if err != nil {
+    return tls.Certificate{}, errors.Wrapf(err, "%s: invalid client certificate %q", pluginName, certPath)
+  }
+  if time.Now().After(leaf.NotAfter) {
+    return tls.Certificate{}, fmt.Errorf("%s: client certificate %q expired on %s",
+      pluginName, certPath, leaf.NotAfter.Format(time.RFC3339))
+  }
+  clientCert.Leaf = leaf
+  return clientCert, nil
+}
+
+/* tlsReloader picks up changes of the root certificate and client certificate files without restarting
+  the container. The client certificate is served through GetClientCertificate; since RootCAs can't be
+  changed on a tls.Config in use, a new transport with the refreshed pool replaces the current one. */
+type tlsReloader struct {
+  rootCaPath string
+  clientCertPath string
+  clientKeyPath string
+
+  clientCert *tls.Certificate
+  transport *http.Transport
+  mu sync.RWMutex
+}
+
+/* newTlsReloader returns nil if no certificate files are configured. */
+func newTlsReloader(info logger.Info, transport *http.Transport) *tlsReloader {
+  tlsReloader := &tlsReloader{
+    rootCaPath: info.Config[logOptRootCaPath],
+    clientCertPath: info.Config[logOptClientCertPath],
+    clientKeyPath: info.Config[logOptClientKeyPath],
+    transport: transport,
+  }
+  if len(tlsReloader.paths()) == 0 {
+    return nil
+  }
+  if certificates := transport.TLSClientConfig.Certificates; len(certificates) > 0 {
+    tlsReloader.clientCert = &certificates[0]
+    transport.TLSClientConfig.GetClientCertificate = tlsReloader.getClientCertificate
+  }
+  return tlsReloader
+}
+
+func (tlsReloader *tlsReloader) paths() []string {
+  var paths []string
+  for _, path := range []string{tlsReloader.rootCaPath, tlsReloader.clientCertPath, tlsReloader.clientKeyPath} {
+    if path != "" {
+      paths = append(paths, path)
+    }
+  }
+  return paths
+}
+
+func (tlsReloader *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+  tlsReloader.mu.RLock()
+  defer tlsReloader.mu.RUnlock()
+  return tlsReloader.clientCert, nil
+}
+
+func (tlsReloader *tlsReloader) RoundTrip(request *http.Request) (*http.Response, error) {
+  tlsReloader.mu.RLock()
+  transport := tlsReloader.transport
+  tlsReloader.mu.RUnlock()
+  return transport.RoundTrip(request)
+}
+
+/* reload loads the certificate files again. If any of them is invalid, e.g. while it's being
+  rotated, the current certificates are kept. */
+func (tlsReloader *tlsReloader) reload() {
+  tlsReloader.mu.RLock()
+  transport := tlsReloader.transport.Clone()
+  tlsReloader.mu.RUnlock()
+
+  if tlsReloader.rootCaPath != "" {
+    rootCaPool, err := loadRootCaPool(tlsReloader.rootCaPath)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: Failed to reload root certificate, keeping the current one. %v", pluginName, err))
+      return
+    }
+    transport.TLSClientConfig.RootCAs = rootCaPool
+  }
+  var clientCert tls.Certificate
+  if tlsReloader.clientCertPath != "" {
+    var err error
+    clientCert, err = loadClientCertificate(tlsReloader.clientCertPath, tlsReloader.clientKeyPath)
+    if err != nil {
+      logrus.Error(fmt.Errorf("%s: Failed to reload client certificate, keeping the current one. %v", pluginName, err))
+      return
+    }
+    transport.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+  }
+
+  tlsReloader.mu.Lock()
+  previous := tlsReloader.transport
+  tlsReloader.transport = transport
+  if tlsReloader.clientCertPath != "" {
+    tlsReloader.clientCert = &clientCert
+  }
+  tlsReloader.mu.Unlock()
+  previous.CloseIdleConnections()
+  logrus.Info(fmt.Sprintf("%s: Reloaded TLS certificates from %s", pluginName, strings.Join(tlsReloader.paths(), ", ")))
+}
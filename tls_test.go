@@ -0,0 +1,341 @@
+package main
+
+import (
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "crypto/rand"
+  "crypto/sha256"
+  "crypto/tls"
+  "crypto/x509"
+  "crypto/x509/pkix"
+  "encoding/base64"
+  "encoding/pem"
+  "io/ioutil"
+  "math/big"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "testing"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+const (
+  testTlsDir = "/tmp/sumo-tls"
+  testClientCertPath = testTlsDir + "/client.crt"
+  testClientKeyPath = testTlsDir + "/client.key"
+  testOtherClientKeyPath = testTlsDir + "/other.key"
+)
+
+/* writeTestCertificate writes a self-signed certificate and its key to the given paths, PEM encoded. */
+func writeTestCertificate(t *testing.T, certPath string, keyPath string, notAfter time.Time) *x509.Certificate {
+  key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  assert.Nil(t, err)
+  template := &x509.Certificate{
+    SerialNumber: big.NewInt(time.Now().UnixNano()),
+    Subject: pkix.Name{CommonName: "sumo-test"},
+    NotBefore: time.Now().Add(-time.Hour),
+    NotAfter: notAfter,
+    KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+    ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+    BasicConstraintsValid: true,
+    IsCA: true,
+  }
+  certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+  assert.Nil(t, err)
+  keyDer, err := x509.MarshalECPrivateKey(key)
+  assert.Nil(t, err)
+
+  assert.Nil(t, os.MkdirAll(testTlsDir, fileMode))
+  if certPath != "" {
+    assert.Nil(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0600))
+  }
+  assert.Nil(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+  cert, err := x509.ParseCertificate(certDer)
+  assert.Nil(t, err)
+  return cert
+}
+
+func TestParseLogOptTlsConfigClientCertificate(t *testing.T) {
+  defer os.RemoveAll(testTlsDir)
+  writeTestCertificate(t, testClientCertPath, testClientKeyPath, time.Now().Add(time.Hour))
+  writeTestCertificate(t, "", testOtherClientKeyPath, time.Now().Add(time.Hour))
+
+  t.Run("matching certificate and key", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptClientCertPath: testClientCertPath,
+        logOptClientKeyPath: testClientKeyPath,
+      },
+    }
+    tlsConfig, err := parseLogOptTlsConfig(info)
+    assert.Nil(t, err)
+    assert.Equal(t, 1, len(tlsConfig.Certificates), "client certificate specified, should be loaded")
+    assert.Equal(t, "sumo-test", tlsConfig.Certificates[0].Leaf.Subject.CommonName, "should load the specified certificate")
+  })
+
+  t.Run("mismatched certificate and key", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptClientCertPath: testClientCertPath,
+        logOptClientKeyPath: testOtherClientKeyPath,
+      },
+    }
+    _, err := parseLogOptTlsConfig(info)
+    assert.Error(t, err, "mismatched certificate and key should return an error")
+    assert.Contains(t, err.Error(), "does not match", "error message should mention the mismatch")
+  })
+
+  t.Run("certificate without key", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptClientCertPath: testClientCertPath,
+      },
+    }
+    _, err := parseLogOptTlsConfig(info)
+    assert.Error(t, err, "certificate without key should return an error")
+    assert.Contains(t, err.Error(), logOptClientKeyPath, "error message should mention the missing option")
+  })
+
+  t.Run("missing key file", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptClientCertPath: testClientCertPath,
+        logOptClientKeyPath: testTlsDir + "/missing.key",
+      },
+    }
+    _, err := parseLogOptTlsConfig(info)
+    assert.Error(t, err, "missing key file should return an error")
+    assert.Contains(t, err.Error(), "client key", "error message should mention the key")
+  })
+
+  t.Run("expired certificate", func(t *testing.T) {
+    testExpiredCertPath := testTlsDir + "/expired.crt"
+    testExpiredKeyPath := testTlsDir + "/expired.key"
+    writeTestCertificate(t, testExpiredCertPath, testExpiredKeyPath, time.Now().Add(-time.Minute))
+    info := logger.Info{
+      Config: map[string]string{
+        logOptClientCertPath: testExpiredCertPath,
+        logOptClientKeyPath: testExpiredKeyPath,
+      },
+    }
+    _, err := parseLogOptTlsConfig(info)
+    assert.Error(t, err, "expired certificate should return an error")
+    assert.Contains(t, err.Error(), "expired", "error message should mention the expiry")
+  })
+
+  t.Run("mutual TLS handshake", func(t *testing.T) {
+    clientCa := x509.NewCertPool()
+    clientCaPem, _ := ioutil.ReadFile(testClientCertPath)
+    clientCa.AppendCertsFromPEM(clientCaPem)
+    server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      w.WriteHeader(http.StatusOK)
+    }))
+    server.TLS = &tls.Config{
+      ClientAuth: tls.RequireAndVerifyClientCert,
+      ClientCAs: clientCa,
+    }
+    server.StartTLS()
+    defer server.Close()
+
+    info := logger.Info{
+      Config: map[string]string{
+        logOptInsecureSkipVerify: "true",
+        logOptClientCertPath: testClientCertPath,
+        logOptClientKeyPath: testClientKeyPath,
+      },
+    }
+    tlsConfig, err := parseLogOptTlsConfig(info)
+    assert.Nil(t, err)
+    testSumoLogger := &sumoLogger{
+      httpSourceUrl: server.URL,
+      httpClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+    }
+    assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: testLine}}),
+      "should present the client certificate to the server")
+  })
+}
+
+func TestParseLogOptTlsConfigHardening(t *testing.T) {
+  t.Run("versions and cipher suites", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptTlsMinVersion: "1.2",
+        logOptTlsMaxVersion: "TLS1.3",
+        logOptTlsCipherSuites: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+      },
+    }
+    tlsConfig, err := parseLogOptTlsConfig(info)
+    assert.Nil(t, err)
+    assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion, "min version specified, should be specified value")
+    assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MaxVersion, "max version specified, should be specified value")
+    assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+      tlsConfig.CipherSuites, "cipher suites specified, should be specified value")
+  })
+
+  for name, config := range map[string]map[string]string{
+    "bad min version": {logOptTlsMinVersion: "1.4"},
+    "bad max version": {logOptTlsMaxVersion: "ssl3"},
+    "min version above max version": {logOptTlsMinVersion: "1.3", logOptTlsMaxVersion: "1.2"},
+    "bad cipher suite": {logOptTlsCipherSuites: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_NOT_A_SUITE"},
+    "bad pin": {logOptTlsPinSha256: "not-a-hash"},
+    "short pin": {logOptTlsPinSha256: "c2hvcnQ="},
+  } {
+    t.Run(name, func(t *testing.T) {
+      _, err := parseLogOptTlsConfig(logger.Info{Config: config})
+      assert.Error(t, err, "invalid TLS options should return an error")
+    })
+  }
+}
+
+func TestSpkiPinning(t *testing.T) {
+  server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(http.StatusOK)
+  }))
+  defer server.Close()
+  serverSpkiHash := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+  serverPin := base64.StdEncoding.EncodeToString(serverSpkiHash[:])
+  otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+  newPinnedSumoLogger := func(pins string) *sumoLogger {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptInsecureSkipVerify: "true",
+        logOptTlsPinSha256: pins,
+      },
+    }
+    tlsConfig, err := parseLogOptTlsConfig(info)
+    assert.Nil(t, err)
+    return &sumoLogger{
+      httpSourceUrl: server.URL,
+      httpClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+    }
+  }
+
+  t.Run("matching pin", func(t *testing.T) {
+    testSumoLogger := newPinnedSumoLogger(otherPin + ",sha256/" + serverPin)
+    assert.Nil(t, testSumoLogger.sendLogs([]*sumoLog{{line: testLine}}),
+      "should accept a server presenting a pinned certificate")
+  })
+
+  t.Run("mismatched pin", func(t *testing.T) {
+    testSumoLogger := newPinnedSumoLogger(otherPin)
+    err := testSumoLogger.sendLogs([]*sumoLog{{line: testLine}})
+    assert.Error(t, err, "should reject a server not presenting a pinned certificate")
+    assert.True(t, isPermanentError(err), "pin mismatch should be a permanent error")
+
+    testLogBatchQueue := make(chan *sumoLogBatch, defaultQueueSizeItems)
+    testSumoLogger.logBatchQueue = testLogBatchQueue
+    handled := make(chan bool)
+    go func() {
+      testSumoLogger.handleBatchedLogs()
+      handled <- true
+    }()
+    testLogBatchQueue <- &sumoLogBatch{logs: []*sumoLog{{line: testLine}}}
+    close(testLogBatchQueue)
+    select {
+    case <-handled:
+    case <-time.After(initialRetryInterval):
+      t.Fatal("should have dropped the batch without retrying")
+    }
+  })
+}
+
+func TestSpkiPinningExtraCertificate(t *testing.T) {
+  pinnedCert := writeTestCertificate(t, "", testTlsDir + "/pinned.key", time.Now().Add(time.Hour))
+  defer os.RemoveAll(testTlsDir)
+  pinnedSpkiHash := sha256.Sum256(pinnedCert.RawSubjectPublicKeyInfo)
+
+  /* the server presents the pinned certificate after its own, unrelated one */
+  server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(http.StatusOK)
+  }))
+  server.StartTLS()
+  defer server.Close()
+  server.TLS.Certificates[0].Certificate = append(server.TLS.Certificates[0].Certificate, pinnedCert.Raw)
+  serverSpkiHash := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+  rootCaPool := x509.NewCertPool()
+  rootCaPool.AddCert(server.Certificate())
+
+  newPinnedSumoLogger := func(tlsConfig *tls.Config) *sumoLogger {
+    return &sumoLogger{
+      httpSourceUrl: server.URL,
+      httpClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+    }
+  }
+
+  t.Run("without verification", func(t *testing.T) {
+    info := logger.Info{
+      Config: map[string]string{
+        logOptInsecureSkipVerify: "true",
+        logOptTlsPinSha256: base64.StdEncoding.EncodeToString(pinnedSpkiHash[:]),
+      },
+    }
+    tlsConfig, err := parseLogOptTlsConfig(info)
+    assert.Nil(t, err)
+    err = newPinnedSumoLogger(tlsConfig).sendLogs([]*sumoLog{{line: testLine}})
+    assert.Error(t, err, "should reject a server only adding the pinned certificate to its chain")
+    assert.True(t, isPermanentError(err), "pin mismatch should be a permanent error")
+  })
+
+  t.Run("verified chain", func(t *testing.T) {
+    tlsConfig := &tls.Config{
+      RootCAs: rootCaPool,
+      VerifyPeerCertificate: verifySpkiPins([][]byte{pinnedSpkiHash[:]}, false),
+    }
+    assert.Error(t, newPinnedSumoLogger(tlsConfig).sendLogs([]*sumoLog{{line: testLine}}),
+      "should reject a server only adding the pinned certificate to its chain")
+
+    tlsConfig = &tls.Config{
+      RootCAs: rootCaPool,
+      VerifyPeerCertificate: verifySpkiPins([][]byte{serverSpkiHash[:]}, false),
+    }
+    assert.Nil(t, newPinnedSumoLogger(tlsConfig).sendLogs([]*sumoLog{{line: testLine}}),
+      "should accept a server whose verified chain has the pinned certificate")
+  })
+}
+
+func TestTlsReloader(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  defer os.RemoveAll(testTlsDir)
+  testRootCaPath := testTlsDir + "/ca.crt"
+  testRootCaKeyPath := testTlsDir + "/ca.key"
+  writeTestCertificate(t, testRootCaPath, testRootCaKeyPath, time.Now().Add(time.Hour))
+  firstCert := writeTestCertificate(t, testClientCertPath, testClientKeyPath, time.Now().Add(time.Hour))
+
+  info := logger.Info{
+    Config: map[string]string{
+      logOptRootCaPath: testRootCaPath,
+      logOptClientCertPath: testClientCertPath,
+      logOptClientKeyPath: testClientKeyPath,
+    },
+  }
+  tlsConfig, err := parseLogOptTlsConfig(info)
+  assert.Nil(t, err)
+  transport := &http.Transport{TLSClientConfig: tlsConfig}
+  testTlsReloader := newTlsReloader(info, transport)
+  assert.NotNil(t, testTlsReloader, "certificate files specified, should have a reloader")
+  assert.Equal(t, []string{testRootCaPath, testClientCertPath, testClientKeyPath}, testTlsReloader.paths())
+
+  clientCert, err := tlsConfig.GetClientCertificate(nil)
+  assert.Nil(t, err)
+  assert.Equal(t, firstCert.SerialNumber, clientCert.Leaf.SerialNumber, "should serve the loaded certificate")
+
+  secondCert := writeTestCertificate(t, testClientCertPath, testClientKeyPath, time.Now().Add(time.Hour))
+  testTlsReloader.reload()
+  clientCert, err = tlsConfig.GetClientCertificate(nil)
+  assert.Nil(t, err)
+  assert.Equal(t, secondCert.SerialNumber, clientCert.Leaf.SerialNumber, "should serve the reloaded certificate")
+  assert.NotEqual(t, transport, testTlsReloader.transport, "should replace the transport")
+
+  reloadedTransport := testTlsReloader.transport
+  assert.Nil(t, ioutil.WriteFile(testRootCaPath, []byte("not a certificate"), 0600))
+  testTlsReloader.reload()
+  assert.Equal(t, reloadedTransport, testTlsReloader.transport, "invalid root certificate, should keep the current transport")
+
+  assert.Nil(t, newTlsReloader(logger.Info{Config: map[string]string{}}, &http.Transport{TLSClientConfig: &tls.Config{}}),
+    "no certificate files specified, should not have a reloader")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strings"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/pkg/errors"
+  "github.com/sirupsen/logrus"
+)
+
+/* The log options the HTTP source URL can be set with. Exactly one of them must be set. */
+var urlLogOpts = []string{
+  logOptUrl,
+  logOptUrlFile,
+  logOptUrlEnv,
+}
+
+func hasLogOptUrl(info logger.Info) bool {
+  for _, logOptKey := range urlLogOpts {
+    if _, exists := info.Config[logOptKey]; exists {
+      return true
+    }
+  }
+  return false
+}
+
+func isUrlLogOpt(logOptKey string) bool {
+  for _, urlLogOpt := range urlLogOpts {
+    if logOptKey == urlLogOpt {
+      return true
+    }
+  }
+  return false
+}
+
+/* resolveLogOptUrl returns the log options with sumo-url set from the file or the plugin's
+  environment variable referenced by sumo-url-file or sumo-url-env, so that the URL and its
+  collector token don't have to be part of the container's configuration. */
+func resolveLogOptUrl(info logger.Info) (logger.Info, error) {
+  var set []string
+  for _, logOptKey := range urlLogOpts {
+    if _, exists := info.Config[logOptKey]; exists {
+      set = append(set, logOptKey)
+    }
+  }
+  if len(set) > 1 {
+    return info, fmt.Errorf("%s: only one of %s can be set", pluginName, strings.Join(set, ", "))
+  }
+
+  var sumoUrl string
+  if urlFile, exists := info.Config[logOptUrlFile]; exists {
+    var err error
+    sumoUrl, err = readUrlFile(urlFile)
+    if err != nil {
+      return info, err
+    }
+  } else if urlEnv, exists := info.Config[logOptUrlEnv]; exists {
+    sumoUrl = strings.TrimSpace(os.Getenv(urlEnv))
+    if sumoUrl == "" {
+      return info, fmt.Errorf("%s: environment variable %s set by %s is empty", pluginName, urlEnv, logOptUrlEnv)
+    }
+  } else {
+    return info, nil
+  }
+
+  config := make(map[string]string, len(info.Config) + 1)
+  for key, value := range info.Config {
+    config[key] = value
+  }
+  config[logOptUrl] = sumoUrl
+  resolvedInfo := info
+  resolvedInfo.Config = config
+  return resolvedInfo, nil
+}
+
+func readUrlFile(urlFile string) (string, error) {
+  content, err := ioutil.ReadFile(urlFile)
+  if err != nil {
+    return "", errors.Wrapf(err, "%s: failed to read %s", pluginName, logOptUrlFile)
+  }
+  sumoUrl := strings.TrimSpace(string(content))
+  if sumoUrl == "" {
+    return "", fmt.Errorf("%s: file %q set by %s is empty", pluginName, urlFile, logOptUrlFile)
+  }
+  return sumoUrl, nil
+}
+
+/* endpoint returns the URL and failover list batches are currently sent to. */
+func (sumoLogger *sumoLogger) endpoint() (string, *sumoFailover) {
+  sumoLogger.urlMu.RLock()
+  defer sumoLogger.urlMu.RUnlock()
+  return sumoLogger.httpSourceUrl, sumoLogger.failover
+}
+
+/* reloadUrl reads the file set by sumo-url-file again, and sends the next batches to the new URL.
+  If the file can't be read or holds an invalid URL, e.g. while it's being rewritten,
+  the current URL is kept. */
+func (sumoLogger *sumoLogger) reloadUrl() {
+  sumoUrl, err := readUrlFile(sumoLogger.urlFile)
+  if err != nil {
+    logrus.Error(fmt.Errorf("%s: Failed to reload the URL, keeping the current one. %v", pluginName, err))
+    return
+  }
+  sumoUrls := parseUrls(sumoUrl, logOptUrlFile)
+  if len(sumoUrls) == 0 {
+    logrus.Error(fmt.Errorf("%s: Failed to reload the URL, keeping the current one. %s must contain a valid URL",
+      pluginName, logOptUrlFile))
+    return
+  }
+  for _, reloadedUrl := range sumoUrls {
+    if reloadedUrl.Scheme == fileSinkScheme {
+      logrus.Error(fmt.Errorf("%s: Failed to reload the URL, keeping the current one. file URLs can't be reloaded",
+        pluginName))
+      return
+    }
+  }
+
+  var failover *sumoFailover
+  if len(sumoUrls) > 1 {
+    failover = newSumoFailover(sumoUrls,
+      parseLogOptIntPositive(sumoLogger.info, logOptFailoverThreshold, defaultFailoverThreshold),
+      parseLogOptDuration(sumoLogger.info, logOptFailbackInterval, defaultFailbackInterval))
+  }
+  sumoLogger.urlMu.Lock()
+  sumoLogger.httpSourceUrl = sumoUrls[0].String()
+  sumoLogger.failover = failover
+  sumoLogger.urlMu.Unlock()
+  logrus.Info(fmt.Sprintf("%s: Reloaded the URL from %s, sending to %s", pluginName, sumoLogger.urlFile, sumoUrls[0].Host))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+  "io/ioutil"
+  "net/http"
+  "os"
+  "testing"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+  "github.com/stretchr/testify/assert"
+)
+
+const (
+  testUrlFilePath = "/tmp/sumo-url"
+  testUrlEnv = "SUMO_TEST_URL"
+  testRotatedHttpSourceUrl = "https://example.org/rotated"
+)
+
+func TestResolveLogOptUrl(t *testing.T) {
+  assert.Nil(t, ioutil.WriteFile(testUrlFilePath, []byte(testHttpSourceUrl + "\n"), 0600))
+  defer os.Remove(testUrlFilePath)
+  os.Setenv(testUrlEnv, testHttpSourceUrl)
+  defer os.Unsetenv(testUrlEnv)
+
+  t.Run("url file", func(t *testing.T) {
+    info := logger.Info{Config: map[string]string{logOptUrlFile: testUrlFilePath}}
+    resolvedInfo, err := resolveLogOptUrl(info)
+    assert.Nil(t, err)
+    assert.Equal(t, testHttpSourceUrl, resolvedInfo.Config[logOptUrl], "should read the url from the file")
+    assert.NotContains(t, info.Config, logOptUrl, "should not modify the log options")
+  })
+
+  t.Run("url env", func(t *testing.T) {
+    resolvedInfo, err := resolveLogOptUrl(logger.Info{Config: map[string]string{logOptUrlEnv: testUrlEnv}})
+    assert.Nil(t, err)
+    assert.Equal(t, testHttpSourceUrl, resolvedInfo.Config[logOptUrl], "should read the url from the environment")
+  })
+
+  for name, config := range map[string]map[string]string{
+    "url and url file": {logOptUrl: testHttpSourceUrl, logOptUrlFile: testUrlFilePath},
+    "missing url file": {logOptUrlFile: "/tmp/sumo-missing-url"},
+    "empty url env": {logOptUrlEnv: "SUMO_TEST_MISSING_URL"},
+  } {
+    t.Run(name, func(t *testing.T) {
+      _, err := resolveLogOptUrl(logger.Info{Config: config})
+      assert.Error(t, err, "invalid url options should return an error")
+    })
+  }
+}
+
+func TestReloadUrl(t *testing.T) {
+  logrus.SetOutput(ioutil.Discard)
+  assert.Nil(t, ioutil.WriteFile(testUrlFilePath, []byte(testHttpSourceUrl), 0600))
+  defer os.Remove(testUrlFilePath)
+
+  info := logger.Info{
+    Config: map[string]string{logOptUrlFile: testUrlFilePath},
+    ContainerName: "/testContainerName",
+  }
+  testSumoLogger, err := newSumoDestination(info, NewMockHttpClient(http.StatusOK), "", nil)
+  assert.Nil(t, err)
+  assert.Equal(t, testUrlFilePath, testSumoLogger.urlFile)
+  httpSourceUrl, failover := testSumoLogger.endpoint()
+  assert.Equal(t, testHttpSourceUrl, httpSourceUrl, "should send to the url from the file")
+  assert.Nil(t, failover)
+
+  assert.Nil(t, ioutil.WriteFile(testUrlFilePath, []byte(testRotatedHttpSourceUrl + "," + testHttpSourceUrl), 0600))
+  testSumoLogger.reloadUrl()
+  httpSourceUrl, failover = testSumoLogger.endpoint()
+  assert.Equal(t, testRotatedHttpSourceUrl, httpSourceUrl, "should send to the reloaded url")
+  assert.NotNil(t, failover, "reloaded failover list, should have a failover")
+
+  for _, content := range []string{"", "file:///tmp/sumo-output"} {
+    assert.Nil(t, ioutil.WriteFile(testUrlFilePath, []byte(content), 0600))
+    testSumoLogger.reloadUrl()
+    httpSourceUrl, _ = testSumoLogger.endpoint()
+    assert.Equal(t, testRotatedHttpSourceUrl, httpSourceUrl, "invalid url file %q, should keep the current url", content)
+  }
+}
+
+func TestParseLogOptDestinationUrlFile(t *testing.T) {
+  info := logger.Info{
+    Config: map[string]string{
+      logOptUrlFile: testUrlFilePath,
+      destinationLogOptKey(logOptUrl, 2): testRotatedHttpSourceUrl,
+    },
+  }
+  destinationInfo, exists := parseLogOptDestination(info, 2)
+  assert.True(t, exists, "should have a destination")
+  assert.Equal(t, testRotatedHttpSourceUrl, destinationInfo.Config[logOptUrl], "should have the destination url")
+  assert.NotContains(t, destinationInfo.Config, logOptUrlFile, "should not inherit the primary url file")
+}
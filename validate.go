@@ -0,0 +1,239 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/docker/docker/daemon/logger"
+  "github.com/sirupsen/logrus"
+)
+
+const (
+  validateCommand = "validate"
+  validateTestMessage = "docker-logging-driver validate test message"
+)
+
+/* The ID of the container the log options are validated for, used by the default tag. */
+var validateContainerID = strings.Repeat("0", 64)
+
+/* logOptFlags collects repeated --opt key=value flags. */
+type logOptFlags map[string]string
+
+func (logOptFlags logOptFlags) String() string {
+  var logOpts []string
+  for key, value := range logOptFlags {
+    logOpts = append(logOpts, key + "=" + value)
+  }
+  sort.Strings(logOpts)
+  return strings.Join(logOpts, ",")
+}
+
+func (logOptFlags logOptFlags) Set(value string) error {
+  parts := strings.SplitN(value, "=", 2)
+  if len(parts) < 2 || parts[0] == "" {
+    return fmt.Errorf("log option must be key=value, got %q", value)
+  }
+  logOptFlags[parts[0]] = parts[1]
+  return nil
+}
+
+/* validator reports the result of each check, counting the problems found. */
+type validator struct {
+  output io.Writer
+  problems int
+}
+
+func (validator *validator) ok(format string, args ...interface{}) {
+  fmt.Fprintf(validator.output, "ok:    " + format + "\n", args...)
+}
+
+func (validator *validator) info(format string, args ...interface{}) {
+  fmt.Fprintf(validator.output, "       " + format + "\n", args...)
+}
+
+func (validator *validator) fail(format string, args ...interface{}) {
+  validator.problems++
+  fmt.Fprintf(validator.output, "error: " + format + "\n", args...)
+}
+
+/* runValidate parses log options given on the command line the same way the plugin does for a container,
+  prints the resulting configuration, and checks that each destination can be reached. It returns the exit code:
+  0 if everything is fine, 1 if any problem was found and 2 for invalid arguments. */
+func runValidate(args []string, output io.Writer) int {
+  flags := flag.NewFlagSet(validateCommand, flag.ContinueOnError)
+  flags.SetOutput(output)
+  logOpts := make(logOptFlags)
+  flags.Var(logOpts, "opt", "log option as key=value, e.g. --opt sumo-url=https://... (repeatable)")
+  containerName := flags.String("container-name", "validate", "container name used for {{Tag}} and the source name")
+  send := flags.Bool("send", false, "send a test message to each destination")
+  message := flags.String("message", validateTestMessage, "test message sent with --send")
+  timeout := flags.Duration("timeout", 10 * time.Second, "timeout of the connection checks")
+  flags.Usage = func() {
+    fmt.Fprintf(output, "Usage: docker-logging-driver %s --opt key=value [--opt key=value ...] [--send]\n", validateCommand)
+    fmt.Fprintln(output, "Each HTTP destination is checked with a real HEAD request to its URL, without any log.")
+    fmt.Fprintln(output, "The files of file:// destinations are only checked for, and created only with --send.")
+    flags.PrintDefaults()
+  }
+  if err := flags.Parse(args); err != nil {
+    return 2
+  }
+  if flags.NArg() > 0 {
+    flags.Usage()
+    return 2
+  }
+
+  /* problems are reported by the validator, not logged again */
+  previousLogOutput := logrus.StandardLogger().Out
+  logrus.SetOutput(ioutil.Discard)
+  defer logrus.SetOutput(previousLogOutput)
+
+  validator := &validator{output: output}
+  info := logger.Info{
+    Config: logOpts,
+    ContainerID: validateContainerID,
+    ContainerName: "/" + *containerName,
+  }
+  info, err := resolveLogOpts(info)
+  if err != nil {
+    validator.fail("%v", err)
+    return 1
+  }
+  validator.printLogOpts(info)
+  if !hasLogOptUrl(info) {
+    validator.fail("must provide log-opt: %s, %s or %s", logOptUrl, logOptUrlFile, logOptUrlEnv)
+    return 1
+  }
+  for _, err := range append(unknownLogOpts(info), invalidLogOpts(info)...) {
+    validator.fail("%v", err)
+  }
+
+  validateSumoLogger, _, err := buildSumoLogger(info)
+  if err != nil {
+    validator.fail("%v", err)
+    return 1
+  }
+  defer validateSumoLogger.closeDestinations()
+  validator.printSumoLogger(validateSumoLogger)
+
+  for i, destination := range append([]*sumoLogger{validateSumoLogger}, validateSumoLogger.destinations...) {
+    validator.checkDestination(i + 1, destination, *timeout)
+    if *send {
+      if err := destination.sendLogs([]*sumoLog{{line: []byte(*message), source: "stdout"}}); err != nil {
+        validator.fail("destination %d: failed to send test message: %v", i + 1, err)
+      } else {
+        validator.ok("destination %d: sent test message", i + 1)
+      }
+    }
+  }
+
+  if validator.problems > 0 {
+    fmt.Fprintf(output, "%d problem(s) found\n", validator.problems)
+    return 1
+  }
+  return 0
+}
+
+func (validator *validator) printLogOpts(info logger.Info) {
+  fmt.Fprintln(validator.output, "Resolved log options:")
+  for _, key := range sortedLogOptKeys(info) {
+    validator.info("%s=%s", key, redactLogOptValue(info.Config[key]))
+  }
+}
+
+func (validator *validator) printSumoLogger(primary *sumoLogger) {
+  fmt.Fprintln(validator.output, "Configuration:")
+  validator.info("batch size: %d bytes, sending interval: %s, queue size: %d batches",
+    primary.batchSize, primary.sendingInterval, cap(primary.logBatchQueue))
+  if primary.proxyUrl != nil {
+    validator.info("proxy: %s", redactUrl(primary.proxyUrl.String()))
+  }
+  validator.info("routes: %d, dedup: %t", len(primary.routes), primary.dedup != nil)
+  for i, destination := range append([]*sumoLogger{primary}, primary.destinations...) {
+    httpSourceUrl, failover := destination.endpoint()
+    validator.info("destination %d: %s", i + 1, redactUrl(httpSourceUrl))
+    if failover != nil {
+      for _, endpoint := range failover.endpoints[1:] {
+        validator.info("  failover endpoint %d: %s", endpoint.index + 1, redactUrl(endpoint.url.String()))
+      }
+    }
+    compression := "none"
+    if destination.autoCompression != nil {
+      compression = fmt.Sprintf("%s level auto (cpu budget %g%%)", destination.contentEncoding(),
+        destination.autoCompression.budget * 100)
+    } else if destination.gzipCompression {
+      compression = fmt.Sprintf("%s level %d", destination.contentEncoding(), destination.gzipCompressionLevel)
+    }
+    if destination.gzipCompression && destination.compressMinSize > 0 {
+      compression += fmt.Sprintf(", batches under %d bytes uncompressed", destination.compressMinSize)
+    }
+    validator.info("  compression: %s, category: %q, name: %q, host: %q",
+      compression, destination.sourceCategory, destination.sourceName, destination.sourceHost)
+  }
+}
+
+/* checkDestination connects to each endpoint of the destination, which goes through the proxy and the
+  TLS handshake with the configured certificates, without sending any log. */
+func (validator *validator) checkDestination(index int, destination *sumoLogger, timeout time.Duration) {
+  httpSourceUrl, failover := destination.endpoint()
+  if fileSink, isFileSink := destination.httpClient.(*fileSink); isFileSink {
+    validator.checkFileSink(index, fileSink)
+    return
+  }
+  urls := []string{httpSourceUrl}
+  if failover != nil {
+    urls = nil
+    for _, endpoint := range failover.endpoints {
+      urls = append(urls, endpoint.url.String())
+    }
+  }
+  for _, endpointUrl := range urls {
+    if err := checkEndpoint(destination.httpClient, endpointUrl, timeout); err != nil {
+      validator.fail("destination %d: failed to connect to %s: %v", index, redactUrl(endpointUrl), err)
+    } else {
+      validator.ok("destination %d: connected to %s", index, redactUrl(endpointUrl))
+    }
+  }
+}
+
+/* checkFileSink checks the directory of the file without creating anything, which the plugin does later. */
+func (validator *validator) checkFileSink(index int, fileSink *fileSink) {
+  dir := filepath.Dir(fileSink.path)
+  dirInfo, err := os.Stat(dir)
+  switch {
+  case os.IsNotExist(err):
+    validator.ok("destination %d: writing to local file %s, its directory will be created", index, fileSink.path)
+  case err != nil:
+    validator.fail("destination %d: failed to check the directory of %s: %v", index, fileSink.path, err)
+  case !dirInfo.IsDir():
+    validator.fail("destination %d: %s is not a directory", index, dir)
+  default:
+    validator.ok("destination %d: writing to local file %s", index, fileSink.path)
+  }
+}
+
+func checkEndpoint(httpClient HttpClient, endpointUrl string, timeout time.Duration) error {
+  request, err := http.NewRequest("HEAD", endpointUrl, nil)
+  if err != nil {
+    return redactUrlError(err)
+  }
+  if client, ok := httpClient.(*http.Client); ok {
+    timeoutClient := *client
+    timeoutClient.Timeout = timeout
+    httpClient = &timeoutClient
+  }
+  /* any response means the connection, including the TLS handshake, succeeded */
+  response, err := httpClient.Do(request)
+  if err != nil {
+    return redactUrlError(err)
+  }
+  response.Body.Close()
+  return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+  "bytes"
+  "compress/gzip"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestRunValidate(t *testing.T) {
+  messages := make(chan string, 10)
+  server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "POST" {
+      reader, _ := gzip.NewReader(r.Body)
+      message, _ := ioutil.ReadAll(reader)
+      messages <- string(message)
+    }
+    w.WriteHeader(http.StatusOK)
+  }))
+  defer server.Close()
+  serverUrl := server.URL + "/receiver/v1/http/validateToken0123456789"
+
+  t.Run("valid options and test message", func(t *testing.T) {
+    var output bytes.Buffer
+    exitCode := runValidate([]string{
+      "--opt", logOptUrl + "=" + serverUrl,
+      "--opt", logOptInsecureSkipVerify + "=true",
+      "--opt", logOptBatchSize + "=2MB",
+      "--send",
+      "--message", "hello from validate",
+    }, &output)
+    assert.Equal(t, 0, exitCode, "valid options, should exit with 0. output: %s", output.String())
+    assert.Contains(t, output.String(), "batch size: 2000000 bytes", "should print the resolved configuration")
+    assert.Contains(t, output.String(), "ok:    destination 1: connected to", "should check the connection")
+    assert.NotContains(t, output.String(), "validateToken", "should not print the token")
+    select {
+    case message := <-messages:
+      assert.Equal(t, "hello from validate\n", message, "should send the test message")
+    case <-time.After(time.Second):
+      t.Fatal("should send the test message")
+    }
+  })
+
+  t.Run("failed handshake", func(t *testing.T) {
+    var output bytes.Buffer
+    exitCode := runValidate([]string{"--opt", logOptUrl + "=" + serverUrl}, &output)
+    assert.Equal(t, 1, exitCode, "untrusted server certificate, should exit with 1")
+    assert.Contains(t, output.String(), "error: destination 1: failed to connect")
+  })
+
+  t.Run("invalid options", func(t *testing.T) {
+    var output bytes.Buffer
+    exitCode := runValidate([]string{
+      "--opt", logOptUrl + "=" + serverUrl,
+      "--opt", logOptInsecureSkipVerify + "=true",
+      "--opt", "sumo-bach-size=2MB",
+      "--opt", logOptQueueSize + "=many",
+    }, &output)
+    assert.Equal(t, 1, exitCode, "invalid options, should exit with 1")
+    assert.Contains(t, output.String(), "did you mean sumo-batch-size?")
+    assert.Contains(t, output.String(), logOptQueueSize)
+    assert.Contains(t, output.String(), "2 problem(s) found")
+  })
+
+  t.Run("file url", func(t *testing.T) {
+    defer os.RemoveAll(testFileSinkDir)
+    var output bytes.Buffer
+    exitCode := runValidate([]string{"--opt", logOptUrl + "=file://" + testFileSinkPath}, &output)
+    assert.Equal(t, 0, exitCode, "valid file url, should exit with 0. output: %s", output.String())
+    assert.Contains(t, output.String(), "its directory will be created")
+    _, err := os.Stat(testFileSinkDir)
+    assert.True(t, os.IsNotExist(err), "should not create the directory of the file")
+  })
+
+  t.Run("missing url", func(t *testing.T) {
+    var output bytes.Buffer
+    assert.Equal(t, 1, runValidate([]string{"--opt", logOptBatchSize + "=2MB"}, &output), "missing url, should exit with 1")
+  })
+
+  t.Run("bad arguments", func(t *testing.T) {
+    var output bytes.Buffer
+    assert.Equal(t, 2, runValidate([]string{"--opt", "no-value"}, &output), "bad option, should exit with 2")
+    assert.Equal(t, 2, runValidate([]string{"extra"}, &output), "extra argument, should exit with 2")
+  })
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+  "os"
+  "time"
+)
+
+type fileState struct {
+  modTime time.Time
+  size int64
+  exists bool
+}
+
+func statFile(path string) fileState {
+  info, err := os.Stat(path)
+  if err != nil {
+    return fileState{}
+  }
+  return fileState{
+    modTime: info.ModTime(),
+    size: info.Size(),
+    exists: true,
+  }
+}
+
+/* fileWatcher polls files for changes of their modification time or size.
+  Polling is used rather than inotify, since files such as Docker secrets
+  are often replaced through symlinks or bind mounts. */
+type fileWatcher struct {
+  states map[string]fileState
+}
+
+func newFileWatcher(paths []string) *fileWatcher {
+  fileWatcher := &fileWatcher{
+    states: make(map[string]fileState),
+  }
+  for _, path := range paths {
+    fileWatcher.states[path] = statFile(path)
+  }
+  return fileWatcher
+}
+
+/* changed returns whether any of the files changed since the previous call. */
+func (fileWatcher *fileWatcher) changed() bool {
+  changed := false
+  for path, previous := range fileWatcher.states {
+    current := statFile(path)
+    if current != previous {
+      fileWatcher.states[path] = current
+      changed = true
+    }
+  }
+  return changed
+}
+
+/* watchFiles calls onChange every time any of the files changes, until done is closed. */
+func watchFiles(done <-chan struct{}, interval time.Duration, paths []string, onChange func()) {
+  fileWatcher := newFileWatcher(paths)
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-done:
+      return
+    case <-ticker.C:
+      if fileWatcher.changed() {
+        onChange()
+      }
+    }
+  }
+}
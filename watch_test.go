@@ -0,0 +1,44 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+)
+
+const testWatchedFilePath = "/tmp/sumo-watched"
+
+func TestWatchFiles(t *testing.T) {
+  assert.Nil(t, ioutil.WriteFile(testWatchedFilePath, []byte("first"), 0600))
+  defer os.Remove(testWatchedFilePath)
+
+  changes := make(chan bool, 1)
+  done := make(chan struct{})
+  defer close(done)
+  go watchFiles(done, 10*time.Millisecond, []string{testWatchedFilePath}, func() {
+    changes <- true
+  })
+
+  select {
+  case <-changes:
+    t.Fatal("file not changed, should not call onChange")
+  case <-time.After(50 * time.Millisecond):
+  }
+
+  assert.Nil(t, ioutil.WriteFile(testWatchedFilePath, []byte("second version"), 0600))
+  select {
+  case <-changes:
+  case <-time.After(time.Second):
+    t.Fatal("file changed, should call onChange")
+  }
+
+  assert.Nil(t, os.Remove(testWatchedFilePath))
+  select {
+  case <-changes:
+  case <-time.After(time.Second):
+    t.Fatal("file removed, should call onChange")
+  }
+}